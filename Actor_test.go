@@ -40,7 +40,7 @@ type getValer interface {
 	getVal() string
 }
 
-type Shutdown struct{}
+type shutdownReq struct{}
 
 func setupBasicAG(name string, gen func(int) Receive,
 	num int) *ActorGroup {
@@ -69,7 +69,7 @@ func genAccumulatorActor() Receive {
 			v = tv + m.val
 		case EchoInt:
 			m.ch <- v
-		case Shutdown:
+		case shutdownReq:
 			env.Suicide()
 		}
 	}
@@ -151,7 +151,7 @@ func genEchoActor(val int) Receive {
 	v := val
 	return func(msg Msg, env *ActorEnv) {
 		switch m := msg[0].(type) {
-		case Shutdown:
+		case shutdownReq:
 			env.Suicide()
 		case EchoPacket:
 			m.ch <- m.val
@@ -186,11 +186,11 @@ func TestHeirarchicalActors(t *testing.T) {
 func TestSelfDestruct(t *testing.T) {
 	numActs := 5
 	ag := setupBasicAG("SelfDestruct", genEchoActor, numActs)
-	shutdownMsg := Msg{Shutdown{}}
+	shutdownMsg := Msg{shutdownReq{}}
 	ag.SendAll(shutdownMsg)
 
 	time.Sleep(500000 * time.Nanosecond)
-	if len(ag.guardian.children) > 0 {
+	if len(ag.guardian.env.GetChildren()) > 0 {
 		t.Errorf("Kids failed to self destruct (timeout?)")
 	}
 	members := ag.getMembers()
@@ -219,7 +219,7 @@ func TestFarm(t *testing.T) {
 	if sum != 0 {
 		t.Errorf("Values did not sum properly")
 	}
-	ag.SendAll(Msg{Shutdown{}})
+	ag.SendAll(Msg{shutdownReq{}})
 	ag.GracefulPassiveShutdown()
 }
 
@@ -228,10 +228,10 @@ func TestSendByName(t *testing.T) {
 	ag := setupBasicAG("TestSendByName", genEchoActor, 2)
 	names := ag.GetAllChildren()
 	for _, n := range names {
-		ag.SendByName(n, Msg{Shutdown{}})
+		ag.SendByName(n, Msg{shutdownReq{}})
 	}
 	checkNeg := ag.SendByName("IntentionalInvalidName",
-		Msg{Shutdown{}})
+		Msg{shutdownReq{}})
 	if checkNeg {
 		t.Errorf("Improper response from ag.SendByName()" +
 			" to a non-existant actor")
@@ -412,3 +412,101 @@ func TestAGDB(t *testing.T) {
 	}
 	ag.GracefulPassiveShutdown()
 }
+
+type seqMsg struct {
+	sender int
+	seq    int
+}
+
+type seqReport struct {
+	ch chan int
+}
+
+// The actor counts messages which arrive out of order with
+// respect to their sender's previous message.
+func genSequenceChecker() Receive {
+	last := make(map[int]int)
+	violations := 0
+	return func(msg Msg, env *ActorEnv) {
+		switch m := msg[0].(type) {
+		case seqMsg:
+			if prev, ok := last[m.sender]; ok && m.seq != prev+1 {
+				violations++
+			}
+			last[m.sender] = m.seq
+		case seqReport:
+			m.ch <- violations
+		}
+	}
+}
+
+func checkFIFO(t *testing.T, ag *ActorGroup, target *Actor,
+	senders, perSender int) {
+
+	done := make(chan bool)
+	for s := 0; s < senders; s++ {
+		go func(s int) {
+			for i := 0; i < perSender; i++ {
+				if err := target.Send(Msg{seqMsg{s, i}}); err != nil {
+					t.Errorf("Send() failed: %v", err)
+				}
+			}
+			done <- true
+		}(s)
+	}
+	for s := 0; s < senders; s++ {
+		<-done
+	}
+	ch := make(chan int)
+	target.Send(Msg{seqReport{ch}})
+	if v := <-ch; v != 0 {
+		t.Errorf("%v messages arrived out of order", v)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+// Messages from one sender must be received in the order sent
+func TestSendFIFOSingleSender(t *testing.T) {
+	ag := NewActorGroup("TestSendFIFOSingleSender")
+	checkFIFO(t, ag, ag.NewActor(genSequenceChecker()), 1, 10000)
+}
+
+func TestSendFIFOManySenders(t *testing.T) {
+	ag := NewActorGroup("TestSendFIFOManySenders")
+	checkFIFO(t, ag, ag.NewActor(genSequenceChecker()), 20, 2000)
+}
+
+func TestSendFIFOBoundedMailbox(t *testing.T) {
+	ag := NewActorGroup("TestSendFIFOBoundedMailbox")
+	a := ag.NewOptionedActor(&ActorOptions{
+		Receive: genSequenceChecker(),
+		Mailbox: Mailbox{Capacity: 4, Policy: Block},
+	})
+	checkFIFO(t, ag, a, 10, 1000)
+}
+
+// Ordering also holds between actors, and for SendByName
+func TestSendFIFOBetweenActors(t *testing.T) {
+	const senders, perSender = 6, 2000
+	ag := NewActorGroup("TestSendFIFOBetweenActors")
+	checker := ag.NewNamedActor("checker", genSequenceChecker())
+	done := make(chan bool, senders)
+	for s := 0; s < senders; s++ {
+		s := s
+		ag.NewActor(func(msg Msg, env *ActorEnv) {
+			for i := 0; i < perSender; i++ {
+				if s%2 == 0 {
+					checker.Send(Msg{seqMsg{s, i}})
+				} else {
+					env.This.Group.SendByName("checker",
+						Msg{seqMsg{s, i}})
+				}
+			}
+			done <- true
+		}).Send(Msg{"go"})
+	}
+	for s := 0; s < senders; s++ {
+		<-done
+	}
+	checkFIFO(t, ag, checker, 0, 0)
+}
@@ -0,0 +1,100 @@
+package actor
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func genDoublerActor() Receive {
+	return func(msg Msg, env *ActorEnv) {
+		switch m := msg[0].(type) {
+		case int:
+			env.Reply(Msg{m * 2})
+		case shutdownReq:
+			env.Suicide()
+		}
+	}
+}
+
+func TestAskReply(t *testing.T) {
+	ag := NewActorGroup("TestAskReply")
+	a := ag.NewActor(genDoublerActor())
+	resp, err := a.Ask(Msg{21}, time.Second).Get()
+	if err != nil {
+		t.Fatalf("Ask() failed: %v", err)
+	}
+	if resp[0].(int) != 42 {
+		t.Errorf("Expected 42, received %v", resp[0])
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestAskTimeout(t *testing.T) {
+	ag := NewActorGroup("TestAskTimeout")
+	a := ag.NewActor(EmptyReceive)
+	_, err := a.Ask(Msg{"ignored"}, time.Millisecond).Get()
+	if err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout, received %v", err)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestAskTargetDies(t *testing.T) {
+	ag := NewActorGroup("TestAskTargetDies")
+	a := ag.NewActor(genDieOnInputActor())
+	_, err := a.Ask(Msg{"die"}, 0).Get()
+	if err != ErrActorDead {
+		t.Errorf("Expected ErrActorDead, received %v", err)
+	}
+	_, err = a.Ask(Msg{"again"}, 0).Get()
+	if err != ErrActorDead {
+		t.Errorf("Expected ErrActorDead for a dead actor, "+
+			"received %v", err)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFutureComposition(t *testing.T) {
+	ag := NewActorGroup("TestFutureComposition")
+	a := ag.NewActor(genDoublerActor())
+	fs := make([]*Future, 0)
+	for i := 0; i < 5; i++ {
+		fs = append(fs, a.Ask(Msg{i}, time.Second).Then(
+			func(m Msg) (Msg, error) {
+				return Msg{m[0].(int) + 1}, nil
+			}))
+	}
+	results, err := WaitAll(fs...)
+	if err != nil {
+		t.Fatalf("WaitAll() failed: %v", err)
+	}
+	for i, r := range results {
+		if r[0].(int) != i*2+1 {
+			t.Errorf("Result %v was %v", i, r[0])
+		}
+	}
+	never := ag.NewActor(EmptyReceive).Ask(Msg{0}, time.Second)
+	i, resp, err := WaitAny(never, a.Ask(Msg{4}, time.Second))
+	if i != 1 || err != nil || resp[0].(int) != 8 {
+		t.Errorf("WaitAny() returned %v, %v, %v", i, resp, err)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestWaitAnyLeavesNoWaiters(t *testing.T) {
+	ag := NewActorGroup("TestWaitAnyLeavesNoWaiters")
+	a := ag.NewActor(genDoublerActor())
+	never := ag.NewActor(EmptyReceive).Ask(Msg{0}, 0)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if j, _, _ := WaitAny(never, a.Ask(Msg{i}, time.Second)); j != 1 {
+			t.Fatalf("WaitAny() returned %v", j)
+		}
+	}
+	if after := runtime.NumGoroutine(); after >= before+100 {
+		t.Errorf("WaitAny() left waiters: %v goroutines, was %v",
+			after, before)
+	}
+	ag.GracefulActiveShutdown()
+}
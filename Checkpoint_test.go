@@ -0,0 +1,133 @@
+package actor
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+// runCheckpointedFarm runs a farm named "batch" squaring 1 to 6,
+// which panics on any of fail, and returns its WorkComplete.
+func runCheckpointedFarm(t *testing.T, store CheckpointStore,
+	fail ...int) WorkComplete {
+
+	ag := NewActorGroup("TestFarmCheckpoint")
+	f := genFlakyFarm(WorkerPool, nil)
+	f.Source = SourceFromSeq(func(yield func(Msg) bool) {
+		for i := 1; i <= 6; i++ {
+			if !yield(Msg{i}) {
+				return
+			}
+		}
+	})
+	f.Checkpoint = &FarmCheckpoint{
+		Store:  store,
+		TaskID: func(msg Msg) string { return strconv.Itoa(msg[0].(int)) },
+	}
+	f.mu.Lock()
+	for i := 1; i <= 6; i++ {
+		f.tried[i] = true // Only fail those asked to
+	}
+	for _, n := range fail {
+		f.tried[n] = false
+	}
+	f.mu.Unlock()
+	ag.NewNamedActorFarm("batch", f)
+	_, wc := collectSquares(t, f.out)
+	ag.GracefulActiveShutdown()
+	return wc
+}
+
+func TestFarmCheckpoint(t *testing.T) {
+	store, err := NewFileCheckpointStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	wc := runCheckpointedFarm(t, store, 3, 5)
+	if wc.Succeeded != 4 || wc.Failed != 2 {
+		t.Fatalf("Unexpected first run %+v", wc)
+	}
+	cp, err := store.Load("TestFarmCheckpoint:batch")
+	if err != nil || len(cp.Dispatched) != 6 || len(cp.Completed) != 4 {
+		t.Errorf("Unexpected checkpoint %+v %v", cp, err)
+	}
+	store.mu.Lock()
+	if len(store.files) != 0 {
+		t.Error("Checkpoint file left open")
+	}
+	store.mu.Unlock()
+	wc = runCheckpointedFarm(t, store)
+	if wc.Skipped != 4 || wc.Redone != 2 || wc.Dispatched != 2 ||
+		wc.Succeeded != 2 {
+
+		t.Errorf("Unexpected resumed run %+v", wc)
+	}
+	// Finished cleanly, so the next run starts afresh
+	wc = runCheckpointedFarm(t, store)
+	if wc.Skipped != 0 || wc.Succeeded != 6 {
+		t.Errorf("Unexpected fresh run %+v", wc)
+	}
+}
+
+func TestFarmCheckpointAbnormalExit(t *testing.T) {
+	store, err := NewFileCheckpointStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	run := func() WorkComplete {
+		ag := NewActorGroup("TestFarmCheckpointAbnormalExit")
+		f := genSquareFarm(OneShot, 2)
+		f.Source = SourceFromSeq(func(yield func(Msg) bool) {
+			for _, n := range []int{1, 0, 2} {
+				if !yield(Msg{n}) {
+					return
+				}
+			}
+		})
+		f.Checkpoint = &FarmCheckpoint{
+			Store:  store,
+			TaskID: func(msg Msg) string { return strconv.Itoa(msg[0].(int)) },
+		}
+		ag.NewNamedActorFarm("batch", f)
+		_, wc := collectSquares(t, f.out)
+		ag.GracefulActiveShutdown()
+		return wc
+	}
+	// The worker given 0 exits abnormally, so 0 is unfinished
+	if wc := run(); wc.Succeeded != 2 || wc.Failed != 1 {
+		t.Fatalf("Unexpected first run %+v", wc)
+	}
+	wc := run()
+	if wc.Skipped != 2 || wc.Dispatched != 1 || len(wc.FailedMsgs) != 1 ||
+		wc.FailedMsgs[0][0] != 0 {
+
+		t.Errorf("Unexpected resumed run %+v", wc)
+	}
+}
+
+func TestFileCheckpointStoreTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	store := &FileCheckpointStore{Dir: dir, Sync: true}
+	store.Dispatched("farm", "a\nb")
+	store.Completed("farm", "a\nb")
+	store.Close()
+	f, _ := os.OpenFile(store.fileName("farm"), os.O_APPEND|os.O_WRONLY,
+		0644)
+	f.WriteString(`C "tor`)
+	f.Close()
+	store = &FileCheckpointStore{Dir: dir}
+	if err := store.Completed("farm", "c"); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := store.Load("farm")
+	if err != nil || !cp.Dispatched["a\nb"] || !cp.Completed["a\nb"] ||
+		!cp.Completed["c"] || len(cp.Completed) != 2 {
+		t.Errorf("Unexpected checkpoint %+v %v", cp, err)
+	}
+	store.Clear("farm")
+	if cp, _ := store.Load("farm"); len(cp.Dispatched) != 0 {
+		t.Errorf("Checkpoint not cleared: %+v", cp)
+	}
+}
@@ -0,0 +1,84 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnvContext(t *testing.T) {
+	started := make(chan bool, 1)
+	stopped := make(chan error, 1)
+	ag := NewActorGroup("TestEnvContext")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		started <- true
+		<-env.Context().Done()
+		stopped <- env.Context().Err()
+	})
+	a.Send(Msg{"work"})
+	<-started
+	a.Die()
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled, received %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Context was not canceled by Die()")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestShutdownCtx(t *testing.T) {
+	ag := NewActorGroup("TestShutdownCtx")
+	ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ag.Shutdown(ctx); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestShutdownCtxSurvivors(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan bool)
+	defer close(release)
+	ag := NewActorGroup("TestShutdownCtxSurvivors")
+	ag.NewNamedActor("wedged", genWedgedActor(started, release)).
+		Send(Msg{"stuck"})
+	ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	err := ag.Shutdown(ctx)
+	var se *ShutdownError
+	if !errors.As(err, &se) {
+		t.Fatalf("Expected a ShutdownError, received %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, received %v", se.Err)
+	}
+	if len(se.Survivors) != 1 ||
+		se.Survivors[0] != "TestShutdownCtxSurvivors:wedged" {
+
+		t.Errorf("Unexpected survivors %v", se.Survivors)
+	}
+}
+
+func TestSendCtx(t *testing.T) {
+	ag, a, gate, out := setupGatedActor("TestSendCtx",
+		Mailbox{Capacity: 1, Policy: Block})
+	if err := a.SendCtx(context.Background(), Msg{1}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(),
+		20*time.Millisecond)
+	defer cancel()
+	if err := a.SendCtx(ctx, Msg{2}); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, received %v", err)
+	}
+	drainGated(t, gate, out, []int{0, 1})
+	ag.GracefulActiveShutdown()
+}
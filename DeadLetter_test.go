@@ -0,0 +1,66 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+func genDeadLetterCollector(out chan DeadLetter) Receive {
+	return func(msg Msg, env *ActorEnv) {
+		if dl, ok := msg[0].(DeadLetter); ok {
+			out <- dl
+		}
+	}
+}
+
+func expectDeadLetter(t *testing.T, out chan DeadLetter, body string,
+	reason error) {
+
+	select {
+	case dl := <-out:
+		if dl.Msg[0] != body || dl.Reason != reason {
+			t.Errorf("Expected %v (%v), received %#v", body,
+				reason, dl)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("No dead letter for %v", body)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	out := make(chan DeadLetter, 10)
+	ag := NewActorGroup("TestDeadLetters")
+	ag.SubscribeDeadLetters(ag.NewActor(genDeadLetterCollector(out)))
+
+	dead := ag.NewActor(genDieOnInputActor())
+	notice := make(tDeathNotice)
+	dead.watch(notice)
+	dead.Send(Msg{"die"})
+	<-notice
+	dead.Send(Msg{"to the dead"})
+	expectDeadLetter(t, out, "to the dead", ErrActorDead)
+
+	picky := ag.NewOptionedActor(&ActorOptions{
+		Receive:   EmptyReceive,
+		Validator: func(Msg) bool { return false },
+	})
+	picky.Send(Msg{"rejected"})
+	expectDeadLetter(t, out, "rejected", ErrMsgRejected)
+
+	ag.SendByName("nobody", Msg{"misdirected"})
+	expectDeadLetter(t, out, "misdirected", ErrNoSuchActor)
+
+	_, full, gate, _ := setupGatedActor("TestDeadLettersFull",
+		Mailbox{Capacity: 1, Policy: ToDeadLetters})
+	full.Group.SubscribeDeadLetters(ag.NewActor(
+		genDeadLetterCollector(out)))
+	full.Send(Msg{1})
+	if err := full.Send(Msg{"overflow"}); err != nil {
+		t.Errorf("ToDeadLetters Send() returned %v", err)
+	}
+	expectDeadLetter(t, out, "overflow", ErrMailboxFull)
+	close(gate)
+	full.Group.GracefulActiveShutdown()
+
+	ag.GracefulActiveShutdown()
+}
@@ -0,0 +1,86 @@
+package actor
+
+import (
+	"testing"
+)
+
+type envReport struct {
+	msg    Msg
+	sender *Actor
+	corr   string
+	header string
+}
+
+// Reports each message with its envelope, and answers "ping"
+// with "pong".
+func genEnvelopeReporter(out chan envReport) Receive {
+	return func(msg Msg, env *ActorEnv) {
+		out <- envReport{msg, env.Sender(), env.CorrelationID(),
+			env.Header("trace")}
+		if msg[0] == "ping" {
+			env.Reply(Msg{"pong"})
+		}
+	}
+}
+
+func TestSendEnvelope(t *testing.T) {
+	out := make(chan envReport, 10)
+	ag := NewActorGroup("TestSendEnvelope")
+	a := ag.NewActor(genEnvelopeReporter(out))
+	a.Send(Msg{"plain"})
+	a.SendEnvelope(Msg{"wrapped"}, Envelope{
+		CorrelationID: "c1",
+		Headers:       map[string]string{"trace": "t1"},
+	})
+	r := <-out
+	if r.msg[0] != "plain" || r.sender != nil || r.corr != "" ||
+		r.header != "" {
+		t.Errorf("Plain Send() arrived as %#v", r)
+	}
+	r = <-out
+	if r.msg[0] != "wrapped" || r.corr != "c1" || r.header != "t1" {
+		t.Errorf("SendEnvelope() arrived as %#v", r)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestTellReply(t *testing.T) {
+	out := make(chan envReport, 10)
+	ag := NewActorGroup("TestTellReply")
+	b := ag.NewActor(genEnvelopeReporter(out))
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		if msg[0] == "start" {
+			b.SendEnvelope(Msg{"ping"}, Envelope{
+				Sender:        env.This,
+				CorrelationID: "c2",
+			})
+			return
+		}
+		out <- envReport{msg, env.Sender(), env.CorrelationID(), ""}
+	})
+	a.Send(Msg{"start"})
+	r := <-out
+	if r.msg[0] != "ping" || r.sender != a {
+		t.Errorf("Expected ping from a, received %#v", r)
+	}
+	r = <-out
+	if r.msg[0] != "pong" || r.sender != b || r.corr != "c2" {
+		t.Errorf("Expected pong from b for c2, received %#v", r)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestEnvelopeValidated(t *testing.T) {
+	ag := NewActorGroup("TestEnvelopeValidated")
+	a := ag.NewOptionedActor(&ActorOptions{
+		Receive:   func(msg Msg, env *ActorEnv) {},
+		Validator: func(msg Msg) bool { return msg[0] == "ok" },
+	})
+	if err := a.SendEnvelope(Msg{"ok"}, Envelope{}); err != nil {
+		t.Errorf("Valid message refused: %v", err)
+	}
+	if err := a.SendEnvelope(Msg{"bad"}, Envelope{}); err != ErrMsgRejected {
+		t.Errorf("Expected ErrMsgRejected, received %v", err)
+	}
+	ag.GracefulActiveShutdown()
+}
@@ -0,0 +1,695 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// squareFarm squares ints in a pool of workers, panicking on
+// negative ones and exiting on zero, and reports the results and
+// completion on out.
+type squareFarm struct {
+	hired atomic.Int32
+	out   chan interface{}
+	FarmInfo
+}
+
+func genSquareFarm(mode FarmMode, workers int) *squareFarm {
+	return &squareFarm{
+		out: make(chan interface{}, 100),
+		FarmInfo: FarmInfo{
+			MaxWorkers: workers,
+			DistChan:   make(chan Msg, 10),
+			Mode:       mode,
+		},
+	}
+}
+
+func (f *squareFarm) GenWorker() interface{} {
+	f.hired.Add(1)
+	return func(msg Msg, env *ActorEnv) {
+		n := msg[0].(int)
+		if n < 0 {
+			panic("negative")
+		}
+		if n == 0 {
+			env.Exit("zero")
+			return
+		}
+		env.Return(Msg{n * n})
+		if f.Mode == OneShot {
+			env.Suicide()
+		}
+	}
+}
+
+func (f *squareFarm) GenFarmer() FarmReceive {
+	return func(msg Msg, env *ActorEnv, dispatch DispatchFn) {
+		switch m := msg[0].(type) {
+		case string:
+			dispatch(Msg{len(m)})
+		case int:
+			if m <= 0 {
+				dispatch(msg)
+			} else {
+				f.out <- m
+			}
+		case EndSentinel:
+			dispatch(msg)
+		case WorkComplete:
+			f.out <- m
+		}
+	}
+}
+
+// collectSquares returns the sum of the results reported before
+// WorkComplete, and the WorkComplete.
+func collectSquares(t *testing.T, out chan interface{}) (int,
+	WorkComplete) {
+
+	sum := 0
+	for {
+		select {
+		case v := <-out:
+			switch r := v.(type) {
+			case int:
+				sum += r
+			case WorkComplete:
+				return sum, r
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("No WorkComplete")
+		}
+	}
+}
+
+func TestFarmWorkerPool(t *testing.T) {
+	ag := NewActorGroup("TestFarmWorkerPool")
+	f := genSquareFarm(WorkerPool, 3)
+	farmer := ag.NewActorFarm(f)
+	for _, s := range []string{"a", "bb", "ccc", "dddd", "eeeee"} {
+		for i := 0; i < 4; i++ {
+			farmer.Send(Msg{s})
+		}
+	}
+	farmer.Send(Msg{EndSentinel{}})
+	sum, wc := collectSquares(t, f.out)
+	if sum != 4*(1+4+9+16+25) {
+		t.Errorf("Expected %v, received %v", 4*(1+4+9+16+25), sum)
+	}
+	if n := f.hired.Load(); n != 3 {
+		t.Errorf("Expected 3 workers hired, found %v", n)
+	}
+	if wc.Dispatched != 20 || wc.Succeeded != 20 || wc.Failed != 0 {
+		t.Errorf("Unexpected accounts %+v", wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFarmWorkerPoolReplacesPanicked(t *testing.T) {
+	ag := NewActorGroup("TestFarmWorkerPoolReplacesPanicked")
+	f := genSquareFarm(WorkerPool, 2)
+	farmer := ag.NewActorFarm(f)
+	farmer.Send(Msg{-1})
+	farmer.Send(Msg{"aa"})
+	farmer.Send(Msg{-1})
+	farmer.Send(Msg{"aaa"})
+	farmer.Send(Msg{EndSentinel{}})
+	sum, wc := collectSquares(t, f.out)
+	if sum != 4+9 {
+		t.Errorf("Expected 13, received %v", sum)
+	}
+	if n := f.hired.Load(); n != 4 {
+		t.Errorf("Expected 4 workers hired, found %v", n)
+	}
+	if wc.Succeeded != 2 || wc.Failed != 2 || len(wc.FailedMsgs) != 2 {
+		t.Errorf("Unexpected accounts %+v", wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFarmOneShot(t *testing.T) {
+	ag := NewActorGroup("TestFarmOneShot")
+	f := genSquareFarm(OneShot, 2)
+	farmer := ag.NewActorFarm(f)
+	for _, s := range []string{"a", "bb", "ccc"} {
+		farmer.Send(Msg{s})
+	}
+	farmer.Send(Msg{EndSentinel{}})
+	if sum, _ := collectSquares(t, f.out); sum != 1+4+9 {
+		t.Errorf("Expected 14, received %v", sum)
+	}
+	if n := f.hired.Load(); n != 3 {
+		t.Errorf("Expected a worker per message, found %v", n)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFarmOneShotAbnormalExitFails(t *testing.T) {
+	ag := NewActorGroup("TestFarmOneShotAbnormalExitFails")
+	f := genSquareFarm(OneShot, 2)
+	farmer := ag.NewActorFarm(f)
+	farmer.Send(Msg{"a"})
+	farmer.Send(Msg{0})
+	farmer.Send(Msg{"bb"})
+	farmer.Send(Msg{EndSentinel{}})
+	_, wc := collectSquares(t, f.out)
+	expected := WorkComplete{Dispatched: 3, Succeeded: 2, Failed: 1,
+		FailedMsgs: []Msg{{0}}}
+	if !reflect.DeepEqual(wc, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+// deferringFarm's workers Suicide() in a defer, so that even one
+// which panics dies normally.  Its farmer is held up on the result
+// 4 until gate is closed, so that the ChildDied of a later panic
+// comes after the worker's death.
+type deferringFarm struct {
+	*squareFarm
+	held chan bool
+	gate chan bool
+}
+
+func (f deferringFarm) GenWorker() interface{} {
+	return func(msg Msg, env *ActorEnv) {
+		defer env.Suicide()
+		if n := msg[0].(int); n < 0 {
+			panic("negative")
+		} else {
+			env.Return(Msg{n * n})
+		}
+	}
+}
+
+func (f deferringFarm) GenFarmer() FarmReceive {
+	farmer := f.squareFarm.GenFarmer()
+	return func(msg Msg, env *ActorEnv, dispatch DispatchFn) {
+		if msg[0] == 4 {
+			f.held <- true
+			<-f.gate
+		}
+		farmer(msg, env, dispatch)
+	}
+}
+
+func TestFarmOneShotPanicFails(t *testing.T) {
+	ag := NewActorGroup("TestFarmOneShotPanicFails")
+	f := deferringFarm{genSquareFarm(OneShot, 2), make(chan bool),
+		make(chan bool)}
+	ag.NewActorFarm(f)
+	f.DistChan <- Msg{2}
+	<-f.held
+	f.DistChan <- Msg{-1}
+	time.Sleep(50 * time.Millisecond) // For its death
+	close(f.gate)
+	f.DistChan <- Msg{3}
+	f.DistChan <- Msg{EndSentinel{}}
+	_, wc := collectSquares(t, f.out)
+	expected := WorkComplete{Dispatched: 3, Succeeded: 2, Failed: 1,
+		FailedMsgs: []Msg{{-1}}}
+	if !reflect.DeepEqual(wc, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+// flakyFarm squares ints, panicking on the first attempt at each
+// odd one, and on every attempt at a negative one.
+type flakyFarm struct {
+	squareFarm
+	mu    sync.Mutex
+	tried map[int]bool
+}
+
+func genFlakyFarm(mode FarmMode, retry *FarmRetry) *flakyFarm {
+	f := &flakyFarm{tried: make(map[int]bool)}
+	f.out = make(chan interface{}, 100)
+	f.FarmInfo = FarmInfo{
+		MaxWorkers: 2,
+		DistChan:   make(chan Msg, 10),
+		Mode:       mode,
+		Retry:      retry,
+	}
+	return f
+}
+
+func (f *flakyFarm) GenWorker() interface{} {
+	f.hired.Add(1)
+	return func(msg Msg, env *ActorEnv) {
+		n := msg[0].(int)
+		f.mu.Lock()
+		first := !f.tried[n]
+		f.tried[n] = true
+		f.mu.Unlock()
+		if n < 0 || n%2 == 1 && first {
+			panic(n)
+		}
+		env.Return(Msg{n * n})
+		if f.Mode == OneShot {
+			env.Suicide()
+		}
+	}
+}
+
+func (f *flakyFarm) GenFarmer() FarmReceive {
+	return func(msg Msg, env *ActorEnv, dispatch DispatchFn) {
+		switch m := msg[0].(type) {
+		case int:
+			f.out <- m
+		case WorkComplete:
+			f.out <- m
+		}
+	}
+}
+
+func TestFarmRetries(t *testing.T) {
+	for _, mode := range []FarmMode{OneShot, WorkerPool} {
+		ag := NewActorGroup("TestFarmRetries")
+		f := genFlakyFarm(mode, &FarmRetry{
+			MaxAttempts: 3,
+			Backoff:     &Backoff{MinDelay: 1 * time.Millisecond},
+		})
+		ag.NewActorFarm(f)
+		for _, n := range []int{1, 2, 3, -1} {
+			f.DistChan <- Msg{n}
+		}
+		f.DistChan <- Msg{EndSentinel{}}
+		sum, wc := collectSquares(t, f.out)
+		if sum != 1+4+9 {
+			t.Errorf("Mode %v: expected 14, received %v", mode, sum)
+		}
+		expected := WorkComplete{Dispatched: 8, Succeeded: 3,
+			Retried: 4, Failed: 1, FailedMsgs: []Msg{{-1}}}
+		if !reflect.DeepEqual(wc, expected) {
+			t.Errorf("Mode %v: expected %+v, received %+v", mode,
+				expected, wc)
+		}
+		ag.GracefulActiveShutdown()
+	}
+}
+
+func TestFarmRetryable(t *testing.T) {
+	ag := NewActorGroup("TestFarmRetryable")
+	f := genFlakyFarm(WorkerPool, &FarmRetry{
+		MaxAttempts: 3,
+		Retryable:   func(err interface{}) bool { return err.(int) > 0 },
+	})
+	ag.NewActorFarm(f)
+	f.DistChan <- Msg{-2}
+	f.DistChan <- Msg{3}
+	f.DistChan <- Msg{EndSentinel{}}
+	_, wc := collectSquares(t, f.out)
+	if wc.Retried != 1 || wc.Failed != 1 || wc.Succeeded != 1 {
+		t.Errorf("Unexpected accounts %+v", wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func getFarmStats(t *testing.T, farmer *Actor) FarmStats {
+	v, err := farmer.Ask(Msg{GetFarmStats{}}, 1*time.Second).Get()
+	if err != nil {
+		t.Fatalf("GetFarmStats failed: %v", err)
+	}
+	return v[0].(FarmStats)
+}
+
+// waitFarmStats polls the farmer's stats until ok is satisfied.
+func waitFarmStats(t *testing.T, farmer *Actor,
+	ok func(FarmStats) bool) FarmStats {
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s := getFarmStats(t, farmer)
+		if ok(s) || time.Now().After(deadline) {
+			return s
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// gatedFarm's workers each wait for a value on gate per task.
+// WorkComplete is passed to out.
+type gatedFarm struct {
+	gate chan bool
+	out  chan WorkComplete
+	FarmInfo
+}
+
+func genGatedFarm(mode FarmMode, workers int) *gatedFarm {
+	return &gatedFarm{
+		gate: make(chan bool),
+		out:  make(chan WorkComplete, 1),
+		FarmInfo: FarmInfo{
+			MaxWorkers: workers,
+			DistChan:   make(chan Msg, 10),
+			Mode:       mode,
+		},
+	}
+}
+
+func (f *gatedFarm) GenWorker() interface{} {
+	return func(msg Msg, env *ActorEnv) {
+		<-f.gate
+		if f.Mode == OneShot {
+			env.Suicide()
+		}
+	}
+}
+
+func (f *gatedFarm) GenFarmer() FarmReceive {
+	return func(msg Msg, env *ActorEnv, dispatch DispatchFn) {
+		if wc, ok := msg[0].(WorkComplete); ok {
+			f.out <- wc
+		}
+	}
+}
+
+func expectWorkComplete(t *testing.T, out chan WorkComplete) WorkComplete {
+	select {
+	case wc := <-out:
+		return wc
+	case <-time.After(2 * time.Second):
+		t.Fatal("No WorkComplete")
+	}
+	return WorkComplete{}
+}
+
+func TestFarmAutoscale(t *testing.T) {
+	ag := NewActorGroup("TestFarmAutoscale")
+	f := genGatedFarm(WorkerPool, 0)
+	f.Autoscale = &FarmAutoscale{
+		MinWorkers:    1,
+		MaxWorkers:    4,
+		ScaleUpQueue:  2,
+		ScaleDownIdle: 20 * time.Millisecond,
+	}
+	farmer := ag.NewActorFarm(f)
+	s := waitFarmStats(t, farmer, func(s FarmStats) bool {
+		return s.Idle == 1
+	})
+	if s.Idle != 1 || s.Active != 0 {
+		t.Errorf("Expected 1 idle worker at first, found %+v", s)
+	}
+	for i := 0; i < 10; i++ {
+		f.DistChan <- Msg{i}
+	}
+	// Workers are added until at most 2 tasks wait, or there are
+	// MaxWorkers of them; as many tasks again are taken to wait
+	s = waitFarmStats(t, farmer, func(s FarmStats) bool {
+		return s.Active == 4 && s.Queued == 4
+	})
+	if s.Active != 4 || s.Queued != 4 || len(f.DistChan) != 2 {
+		t.Errorf("Expected 4 active, 4 queued and 2 not taken, "+
+			"found %+v and %v", s, len(f.DistChan))
+	}
+	for i := 0; i < 10; i++ {
+		f.gate <- true
+	}
+	s = waitFarmStats(t, farmer, func(s FarmStats) bool {
+		return s.Completed == 10 && s.Idle == 1
+	})
+	if s.Completed != 10 || s.Idle != 1 || s.Active != 0 {
+		t.Errorf("Expected the pool to shrink to 1, found %+v", s)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+// unpoolableFarm has workers which cannot be pooled.
+type unpoolableFarm struct {
+	*gatedFarm
+}
+
+func (f unpoolableFarm) GenWorker() interface{} {
+	return 42
+}
+
+func TestFarmWorkerPoolCannotHire(t *testing.T) {
+	ag := NewActorGroup("TestFarmWorkerPoolCannotHire")
+	f := unpoolableFarm{genGatedFarm(WorkerPool, 2)}
+	ag.NewActorFarm(f)
+	f.DistChan <- Msg{1}
+	f.DistChan <- Msg{2}
+	if wc := expectWorkComplete(t, f.out); wc.Failed < 1 ||
+		wc.Succeeded != 0 || wc.Dispatched != 0 {
+
+		t.Errorf("Unexpected accounts %+v", wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFarmAutoscaleFromZero(t *testing.T) {
+	ag := NewActorGroup("TestFarmAutoscaleFromZero")
+	f := genGatedFarm(WorkerPool, 0)
+	f.Autoscale = &FarmAutoscale{MaxWorkers: 4, ScaleUpQueue: 2}
+	ag.NewActorFarm(f)
+	// Below ScaleUpQueue, but there is no worker to take it
+	f.DistChan <- Msg{1}
+	f.DistChan <- Msg{EndSentinel{}}
+	select {
+	case f.gate <- true:
+	case <-time.After(1 * time.Second):
+		t.Fatal("No worker hired")
+	}
+	if wc := expectWorkComplete(t, f.out); wc.Succeeded != 1 {
+		t.Errorf("Unexpected accounts %+v", wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFarmPauseResumeDrain(t *testing.T) {
+	for _, mode := range []FarmMode{OneShot, WorkerPool} {
+		ag := NewActorGroup("TestFarmPauseResumeDrain")
+		f := genGatedFarm(mode, 2)
+		farmer := ag.NewActorFarm(f)
+		farmer.Send(Msg{PauseFarm{}})
+		// Answered after the pause, which tasks on DistChan are not
+		getFarmStats(t, farmer)
+		for i := 0; i < 3; i++ {
+			f.DistChan <- Msg{i}
+		}
+		// Only the task asked for before the pause is taken
+		s := waitFarmStats(t, farmer, func(s FarmStats) bool {
+			return s.Queued == 1
+		})
+		if !s.Paused || s.Queued != 1 || s.Active != 0 ||
+			len(f.DistChan) != 2 {
+
+			t.Errorf("Mode %v: expected 1 queued and 2 not taken "+
+				"while paused, found %+v and %v", mode, s,
+				len(f.DistChan))
+		}
+		farmer.Send(Msg{ResumeFarm{}})
+		waitFarmStats(t, farmer, func(s FarmStats) bool {
+			return s.Active == 2 && s.Queued == 1
+		})
+		f.gate <- true
+		farmer.Send(Msg{DrainFarm{}})
+		f.gate <- true
+		f.gate <- true
+		wc := expectWorkComplete(t, f.out)
+		if wc.Succeeded != 3 || wc.Cancelled {
+			t.Errorf("Mode %v: unexpected accounts %+v", mode, wc)
+		}
+		ag.GracefulActiveShutdown()
+	}
+}
+
+func TestFarmCancel(t *testing.T) {
+	for _, mode := range []FarmMode{OneShot, WorkerPool} {
+		ag := NewActorGroup("TestFarmCancel")
+		f := genGatedFarm(mode, 1)
+		farmer := ag.NewActorFarm(f)
+		for i := 0; i < 4; i++ {
+			f.DistChan <- Msg{i}
+		}
+		// One task is worked on and one waits; the rest are not taken
+		waitFarmStats(t, farmer, func(s FarmStats) bool {
+			return s.Active == 1 && s.Queued == 1
+		})
+		farmer.Send(Msg{CancelFarm{}})
+		wc := expectWorkComplete(t, f.out)
+		if !wc.Cancelled || len(wc.Dropped) != 2 || wc.Succeeded != 0 ||
+			len(f.DistChan) != 2 {
+
+			t.Errorf("Mode %v: unexpected accounts %+v, %v not taken",
+				mode, wc, len(f.DistChan))
+		}
+		close(f.gate) // Frees the Receive of the killed worker
+		ag.GracefulActiveShutdown()
+	}
+}
+
+func TestFarmSources(t *testing.T) {
+	seq := func(yield func(Msg) bool) {
+		for _, s := range []string{"a", "bb", "ccc"} {
+			if !yield(Msg{len(s)}) {
+				return
+			}
+		}
+	}
+	n := 0
+	pull := func() (Msg, error) {
+		if n++; n > 3 {
+			return nil, io.EOF
+		}
+		return Msg{n}, nil
+	}
+	ch := make(chan Msg, 3)
+	for i := 1; i <= 3; i++ {
+		ch <- Msg{i}
+	}
+	close(ch)
+	sources := map[string]FarmSource{
+		"seq":  SourceFromSeq(seq),
+		"func": SourceFromFunc(pull),
+		"chan": SourceFromChan(context.Background(), ch),
+	}
+	for name, src := range sources {
+		ag := NewActorGroup("TestFarmSources")
+		f := genSquareFarm(WorkerPool, 2)
+		f.Source = src
+		ag.NewActorFarm(f)
+		sum, wc := collectSquares(t, f.out)
+		if sum != 1+4+9 || wc.Succeeded != 3 || wc.SourceErr != nil {
+			t.Errorf("%v: unexpected %v, %+v", name, sum, wc)
+		}
+		ag.GracefulActiveShutdown()
+	}
+}
+
+func TestFarmSourceErrors(t *testing.T) {
+	ag := NewActorGroup("TestFarmSourceErrors")
+	ctx, cancel := context.WithCancel(context.Background())
+	f := genSquareFarm(OneShot, 2)
+	ch := make(chan Msg)
+	f.Source = SourceFromChan(ctx, ch)
+	ag.NewActorFarm(f)
+	ch <- Msg{2}
+	cancel()
+	sum, wc := collectSquares(t, f.out)
+	if sum != 4 || wc.SourceErr != context.Canceled {
+		t.Errorf("Unexpected %v, %+v", sum, wc)
+	}
+	boom := errors.New("boom")
+	f = genSquareFarm(WorkerPool, 2)
+	f.Source = SourceFromFunc(func() (Msg, error) { return nil, boom })
+	ag.NewActorFarm(f)
+	if _, wc := collectSquares(t, f.out); wc.SourceErr != boom {
+		t.Errorf("Expected SourceErr boom, received %+v", wc)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFarmSourceBackPressure(t *testing.T) {
+	ag := NewActorGroup("TestFarmSourceBackPressure")
+	f := genGatedFarm(WorkerPool, 1)
+	var pulled atomic.Int32
+	f.Source = SourceFromFunc(func() (Msg, error) {
+		return Msg{int(pulled.Add(1))}, nil // Endless
+	})
+	farmer := ag.NewActorFarm(f)
+	waitFarmStats(t, farmer, func(s FarmStats) bool {
+		return s.Active == 1 && s.Queued == 1
+	})
+	time.Sleep(20 * time.Millisecond)
+	if n := pulled.Load(); n != 2 {
+		t.Errorf("Expected 2 tasks pulled, one worked on and one "+
+			"waiting, found %v", n)
+	}
+	farmer.Send(Msg{DrainFarm{}})
+	for {
+		select {
+		case f.gate <- true:
+			continue
+		case wc := <-f.out:
+			n := int(pulled.Load())
+			if wc.Dispatched != n || wc.Succeeded != n {
+				t.Errorf("Expected all %v tasks pulled done, found %+v",
+					n, wc)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("No WorkComplete")
+		}
+		break
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFarmDispatchWithoutDistChan(t *testing.T) {
+	dead := make(chan DeadLetter, 10)
+	ag := NewActorGroup("TestFarmDispatchWithoutDistChan")
+	ag.SubscribeDeadLetters(ag.NewActor(genDeadLetterCollector(dead)))
+	f := genSquareFarm(OneShot, 2)
+	f.DistChan = nil
+	farmer := ag.NewActorFarm(f)
+	farmer.Send(Msg{"a"})
+	farmer.Send(Msg{"bb"})
+	farmer.Send(Msg{EndSentinel{}})
+	if sum, _ := collectSquares(t, f.out); sum != 1+4 {
+		t.Errorf("Expected 5, received %v", sum)
+	}
+	farmer.Send(Msg{"ccc"})
+	select {
+	case dl := <-dead:
+		if dl.Msg[0] != 3 || dl.Reason != ErrFarmClosed {
+			t.Errorf("Unexpected dead letter %#v", dl)
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Task dispatched to a finished farm not dead lettered")
+	}
+	ag.GracefulActiveShutdown()
+	// The input stopped waiting on the nil DistChan
+	buf := make([]byte, 1<<16)
+	deadline := time.Now().Add(1 * time.Second)
+	for {
+		stacks := string(buf[:runtime.Stack(buf, true)])
+		if !strings.Contains(stacks, "feedFarm") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Farm input left running:\n%s", stacks)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFarmCancelAccountsForPulled(t *testing.T) {
+	for _, mode := range []FarmMode{OneShot, WorkerPool} {
+		ag := NewActorGroup("TestFarmCancelAccountsForPulled")
+		f := genGatedFarm(mode, 2)
+		pulling := make(chan bool, 1)
+		release := make(chan bool)
+		pulled := 0
+		f.Source = SourceFromFunc(func() (Msg, error) {
+			if pulled++; pulled == 4 {
+				pulling <- true
+				<-release // Under way as the farm is cancelled
+			}
+			return Msg{pulled}, nil
+		})
+		farmer := ag.NewActorFarm(f)
+		<-pulling
+		farmer.Send(Msg{CancelFarm{}})
+		getFarmStats(t, farmer) // Answered after the cancel
+		close(release)
+		wc := expectWorkComplete(t, f.out)
+		if len(wc.Dropped) != 4 ||
+			wc.Succeeded+wc.Failed+len(wc.Dropped) != pulled {
+
+			t.Errorf("Mode %v: %v pulled, but accounts %+v", mode,
+				pulled, wc)
+		}
+		close(f.gate)
+		ag.GracefulActiveShutdown()
+	}
+}
@@ -0,0 +1,154 @@
+package actor
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Each activation announces itself on births, and reports the
+// messages it has handled so far.
+func genCountingGrain(births chan string, out chan string) GrainKind {
+	return GrainKind{
+		New: func(id string) *ActorOptions {
+			births <- id
+			count := 0
+			return &ActorOptions{
+				Receive: func(msg Msg, env *ActorEnv) {
+					count++
+					out <- id + ":" + strconv.Itoa(count)
+				},
+			}
+		},
+		IdleTimeout: 30 * time.Millisecond,
+	}
+}
+
+func TestGrainActivation(t *testing.T) {
+	births := make(chan string, 10)
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestGrainActivation")
+	ag.RegisterGrainKind("counter", genCountingGrain(births, out))
+	for i := 0; i < 3; i++ {
+		if err := ag.Grain("counter", "a").Send(Msg{i}); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+	expectEvents(t, out, "a:1", "a:2", "a:3")
+	ag.Grain("counter", "b").Send(Msg{0})
+	expectEvents(t, out, "b:1")
+	if len(births) != 2 {
+		t.Errorf("Expected 2 activations, found %v", len(births))
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestGrainPassivation(t *testing.T) {
+	births := make(chan string, 10)
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestGrainPassivation")
+	ag.RegisterGrainKind("counter", genCountingGrain(births, out))
+	g := ag.Grain("counter", "a")
+	g.Send(Msg{1})
+	expectEvents(t, births, "a")
+	expectEvents(t, out, "a:1")
+	deadline := time.Now().Add(1 * time.Second)
+	for len(ag.GetAllChildren()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := len(ag.GetAllChildren()); n != 0 {
+		t.Errorf("Grain not passivated, %v actors remain", n)
+	}
+	g.Send(Msg{2})
+	expectEvents(t, births, "a")
+	expectEvents(t, out, "a:1")
+	ag.GracefulActiveShutdown()
+}
+
+func TestGrainConcurrentSends(t *testing.T) {
+	births := make(chan string, 100)
+	out := make(chan string, 100)
+	ag := NewActorGroup("TestGrainConcurrentSends")
+	ag.RegisterGrainKind("counter", genCountingGrain(births, out))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ag.Grain("counter", "a").Send(Msg{0}); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 20; i++ {
+		select {
+		case <-out:
+		case <-time.After(1 * time.Second):
+			t.Fatalf("Only %v of 20 messages handled", i)
+		}
+	}
+	if len(births) != 1 {
+		t.Errorf("Expected 1 activation, found %v", len(births))
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestGrainActivatedFromActivation(t *testing.T) {
+	births := make(chan string, 10)
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestGrainActivatedFromActivation")
+	ag.RegisterGrainKind("counter", genCountingGrain(births, out))
+	ag.RegisterGrainKind("relay", GrainKind{
+		New: func(id string) *ActorOptions {
+			// Activates another grain while this one is made
+			ag.Grain("counter", id).Send(Msg{0})
+			return &ActorOptions{Receive: EmptyReceive}
+		},
+	})
+	sent := make(chan error, 1)
+	go func() { sent <- ag.Grain("relay", "a").Send(Msg{0}) }()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Activation deadlocked")
+	}
+	expectEvents(t, out, "a:1")
+	ag.GracefulActiveShutdown()
+}
+
+func TestGrainUnknownKind(t *testing.T) {
+	ag := NewActorGroup("TestGrainUnknownKind")
+	if err := ag.Grain("nothing", "a").Send(Msg{0}); err != ErrNoSuchGrainKind {
+		t.Errorf("Expected ErrNoSuchGrainKind, received %v", err)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestGrainNameTaken(t *testing.T) {
+	births := make(chan string, 10)
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestGrainNameTaken")
+	ag.RegisterGrainKind("counter", genCountingGrain(births, out))
+	ag.NewNamedActor("counter/a", func(msg Msg, env *ActorEnv) {})
+	errc := make(chan error, 1)
+	go func() { errc <- ag.Grain("counter", "a").Send(Msg{1}) }()
+	select {
+	case err := <-errc:
+		if err != ErrGrainNameTaken {
+			t.Errorf("Expected ErrGrainNameTaken, received %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Send() hung")
+	}
+	// Other grains of the kind are unaffected
+	if err := ag.Grain("counter", "b").Send(Msg{1}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	expectEvents(t, out, "b:1")
+	ag.GracefulActiveShutdown()
+}
@@ -0,0 +1,81 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+// Blocks in Receive until release is closed, announcing each
+// message it starts on.
+func genWedgedActor(started chan string, release chan bool) Receive {
+	return func(msg Msg, env *ActorEnv) {
+		if s, ok := msg[0].(string); ok {
+			started <- s
+		}
+		<-release
+	}
+}
+
+func TestKillWedged(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan bool)
+	defer close(release)
+	out := make(chan DeadLetter, 10)
+	oc := make(obitCatcher, 1)
+	ag := NewActorGroup("TestKillWedged")
+	ag.SubscribeDeadLetters(ag.NewActor(genDeadLetterCollector(out)))
+	a := ag.NewActor(genWedgedActor(started, release))
+	a.watch(oc)
+	a.Send(Msg{"stuck"})
+	<-started
+	a.Send(Msg{"queued"})
+	a.Die()
+	expectLife(t, a, deathNotice(a))
+	a.Kill()
+	expectReason(t, oc, Killed)
+	expectDeadLetter(t, out, "queued", ErrActorDead)
+	if err := a.Send(Msg{"late"}); err != ErrActorDead {
+		t.Errorf("Expected ErrActorDead, received %v", err)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestKillSubtree(t *testing.T) {
+	kids := make(chan *Actor, 1)
+	oc := make(obitCatcher, 1)
+	ag := NewActorGroup("TestKillSubtree")
+	ag.NewNamedActor("parent", func(msg Msg, env *ActorEnv) {
+		kids <- env.NewActor(func(msg Msg, env *ActorEnv) {})
+	}).Send(Msg{"spawn"})
+	kid := <-kids
+	kid.watch(oc)
+	if !ag.Kill("parent") {
+		t.Error("Kill() did not find parent")
+	}
+	expectReason(t, oc, Killed)
+	if ag.Kill("nobody") {
+		t.Error("Kill() found an actor which does not exist")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestShutdownKillsAfter(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan bool)
+	defer close(release)
+	ag := NewActorGroup("TestShutdownKillsAfter")
+	ag.KillAfter = 50 * time.Millisecond
+	a := ag.NewActor(genWedgedActor(started, release))
+	a.Send(Msg{"stuck"})
+	<-started
+	done := make(chan bool)
+	go func() {
+		ag.GracefulActiveShutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Error("GracefulActiveShutdown() did not kill a wedged actor")
+	}
+}
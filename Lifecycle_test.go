@@ -0,0 +1,99 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+// hookedClass records its hooks and messages as strings.
+type hookedClass struct {
+	events chan string
+}
+
+func (h *hookedClass) PreStart(env *ActorEnv) {
+	h.events <- "start"
+}
+
+func (h *hookedClass) Receive(msg Msg, env *ActorEnv) {
+	switch m := msg[0].(type) {
+	case boom:
+		panic("boom")
+	case string:
+		h.events <- m
+	}
+}
+
+func (h *hookedClass) PreRestart(env *ActorEnv, reason Reason) {
+	h.events <- "restart " + reason.Kind.String()
+}
+
+func (h *hookedClass) PostStop(env *ActorEnv) {
+	h.events <- "stop"
+}
+
+func expectEvents(t *testing.T, events chan string, expected ...string) {
+	for _, e := range expected {
+		select {
+		case ev := <-events:
+			if ev != e {
+				t.Errorf("Expected %v, received %v", e, ev)
+			}
+		case <-time.After(1 * time.Second):
+			t.Errorf("Expected %v, received nothing", e)
+		}
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	events := make(chan string, 10)
+	setup := func(interface{}) ActorClass {
+		return &hookedClass{events}
+	}
+	ag := NewActorGroup("TestLifecycleHooks")
+	a := ag.GetOrCreateActorObject("hooked", setup, nil)
+	a.Send(Msg{"hello"})
+	expectEvents(t, events, "start", "hello")
+	notice := deathNotice(a)
+	a.Die()
+	expectEvents(t, events, "stop")
+	<-notice
+	ag.GracefulActiveShutdown()
+}
+
+func TestLifecycleRestart(t *testing.T) {
+	events := make(chan string, 10)
+	ag := NewActorGroup("TestLifecycleRestart")
+	sup := ag.NewOptionedActor(&ActorOptions{
+		Supervisor: OneForOne{MaxRestarts: 5},
+		Receive: func(msg Msg, env *ActorEnv) {
+			switch msg[0].(type) {
+			case string:
+				env.NewNamedActorObject("kid", &hookedClass{events})
+			case boom:
+				env.This.SendByName("kid", msg)
+			}
+		},
+	})
+	sup.Send(Msg{"spawn"})
+	expectEvents(t, events, "start")
+	sup.Send(Msg{boom{}})
+	expectEvents(t, events, "restart panic", "stop", "start")
+	ag.GracefulActiveShutdown()
+	expectEvents(t, events, "stop")
+}
+
+func TestFirstLastMessage(t *testing.T) {
+	events := make(chan string, 10)
+	ag := NewActorGroup("TestFirstLastMessage")
+	a := ag.NewNamedOptionedActor("a", &ActorOptions{
+		Receive: func(msg Msg, env *ActorEnv) {
+			events <- msg[0].(string)
+		},
+		FirstMessage: Msg{"first"},
+		LastMessage:  Msg{"last"},
+	})
+	a.Send(Msg{"middle"})
+	a.Die()
+	expectEvents(t, events, "first", "middle", "last")
+	ag.GracefulActiveShutdown()
+}
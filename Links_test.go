@@ -0,0 +1,181 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+// Passes along every Exit it is sent.
+func genExitReporter(out chan Exit) Receive {
+	return func(msg Msg, env *ActorEnv) {
+		if e, ok := msg[0].(Exit); ok {
+			out <- e
+		}
+	}
+}
+
+func deathNotice(a *Actor) tDeathNotice {
+	notice := make(tDeathNotice)
+	a.watch(notice)
+	return notice
+}
+
+func expectDeath(t *testing.T, a *Actor, notice tDeathNotice) {
+	select {
+	case <-notice:
+	case <-time.After(1 * time.Second):
+		t.Errorf("%s did not die", a.Id)
+	}
+}
+
+func expectLife(t *testing.T, a *Actor, notice tDeathNotice) {
+	select {
+	case <-notice:
+		t.Errorf("%s died", a.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLinkAbnormalExit(t *testing.T) {
+	ag := NewActorGroup("TestLinkAbnormalExit")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	c := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	a.Link(b)
+	b.Link(c)
+	bDead, cDead := deathNotice(b), deathNotice(c)
+	a.env.Exit("boom")
+	expectDeath(t, b, bDead)
+	expectDeath(t, c, cDead)
+	ag.GracefulActiveShutdown()
+}
+
+func TestLinkNormalExit(t *testing.T) {
+	ag := NewActorGroup("TestLinkNormalExit")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	a.Link(b)
+	bDead := deathNotice(b)
+	a.Die()
+	expectLife(t, b, bDead)
+	ag.GracefulActiveShutdown()
+}
+
+func TestUnlink(t *testing.T) {
+	ag := NewActorGroup("TestUnlink")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	a.Link(b)
+	b.Unlink(a)
+	bDead := deathNotice(b)
+	a.env.Exit("boom")
+	expectLife(t, b, bDead)
+	ag.GracefulActiveShutdown()
+}
+
+func TestTrapExits(t *testing.T) {
+	out := make(chan Exit, 10)
+	ag := NewActorGroup("TestTrapExits")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b := ag.NewActor(genExitReporter(out))
+	a2 := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b.env.TrapExits(true)
+	a.Link(b)
+	a2.Link(b)
+	bDead := deathNotice(b)
+	a.env.Exit("boom")
+	select {
+	case e := <-out:
+		if e.From != a || e.Reason.Kind != Exited || e.Reason.Value != "boom" {
+			t.Errorf("Expected Exit from a for boom, received %#v", e)
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Trapped Exit never delivered")
+	}
+	a2.Die()
+	select {
+	case e := <-out:
+		if e.From != a2 || e.Reason.Kind != Normal {
+			t.Errorf("Expected normal Exit from a2, received %#v", e)
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Normal Exit never delivered")
+	}
+	expectLife(t, b, bDead)
+	ag.GracefulActiveShutdown()
+}
+
+func TestLinkToDead(t *testing.T) {
+	ag := NewActorGroup("TestLinkToDead")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	aDead := deathNotice(a)
+	a.env.Exit("boom")
+	<-aDead
+	bDead := deathNotice(b)
+	b.Link(a)
+	expectDeath(t, b, bDead)
+	ag.GracefulActiveShutdown()
+}
+
+func TestLinkSupervisedCrash(t *testing.T) {
+	births := make(chan string, 10)
+	died := make(chan ChildDied, 10)
+	ag := NewActorGroup("TestLinkSupervisedCrash")
+	sup := ag.NewOptionedActor(genSupervisor(OneForOne{MaxRestarts: 5},
+		births, died))
+	sup.Send(Msg{[]string{"handler"}})
+	collectBirths(t, births, 1)
+	handler := sup.env.findChild("handler")
+	session := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	session.Link(handler)
+	sessionDead := deathNotice(session)
+	sup.Send(Msg{boom{}, "handler"})
+	expectDeath(t, session, sessionDead)
+	collectBirths(t, births, 1)
+	ag.GracefulActiveShutdown()
+}
+
+func TestLinkFromDead(t *testing.T) {
+	ag := NewActorGroup("TestLinkFromDead")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	aDead := deathNotice(a)
+	a.env.Exit("boom")
+	<-aDead
+	bDead := deathNotice(b)
+	a.Link(b)
+	expectDeath(t, b, bDead)
+	ag.GracefulActiveShutdown()
+}
+
+// An actor dying as Link() runs may signal the other before the
+// link reaches it.
+func TestLinkRacesDeath(t *testing.T) {
+	out := make(chan Exit, 10)
+	ag := NewActorGroup("TestLinkRacesDeath")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	b := ag.NewActor(genExitReporter(out))
+	b.env.TrapExits(true)
+	// The first half of a.Link(b), then a's death
+	aDead := deathNotice(a)
+	a.env.post(a.env.cbox, cLink{b, true})
+	a.env.Exit("boom")
+	<-aDead
+	// Then the second half
+	b.env.post(b.env.cbox, cLink{a, true})
+	select {
+	case e := <-out:
+		if e.From != a || e.Reason.Value != "boom" {
+			t.Errorf("Expected Exit from a for boom, received %#v", e)
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Exit lost")
+	}
+	select {
+	case e := <-out:
+		t.Errorf("Second Exit %#v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+	ag.GracefulActiveShutdown()
+}
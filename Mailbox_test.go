@@ -0,0 +1,129 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+// The actor reports each int it receives, but not before the
+// gate has been opened.
+func genGatedActor(gate chan bool, out chan int) Receive {
+	return func(msg Msg, env *ActorEnv) {
+		switch m := msg[0].(type) {
+		case int:
+			<-gate
+			out <- m
+		}
+	}
+}
+
+// Starts a gated actor with the given mailbox, and sends it 0 to
+// be stuck on, which leaves the mailbox itself empty.
+func setupGatedActor(name string, mb Mailbox) (*ActorGroup, *Actor,
+	chan bool, chan int) {
+
+	gate := make(chan bool)
+	out := make(chan int, 10)
+	ag := NewActorGroup(name)
+	a := ag.NewOptionedActor(&ActorOptions{
+		Receive: genGatedActor(gate, out),
+		Mailbox: mb,
+	})
+	a.Send(Msg{0})
+	for a.env.mbox.len() > 0 {
+		time.Sleep(10 * time.Microsecond)
+	}
+	return ag, a, gate, out
+}
+
+func drainGated(t *testing.T, gate chan bool, out chan int,
+	expected []int) {
+
+	close(gate)
+	for _, e := range expected {
+		if v := <-out; v != e {
+			t.Errorf("Expected %v, received %v", e, v)
+		}
+	}
+	select {
+	case v := <-out:
+		t.Errorf("Unexpected message %v", v)
+	case <-time.After(5 * time.Millisecond):
+	}
+}
+
+func TestMailboxReject(t *testing.T) {
+	ag, a, gate, out := setupGatedActor("TestMailboxReject",
+		Mailbox{Capacity: 2, Policy: Reject})
+	for i := 1; i <= 4; i++ {
+		err := a.Send(Msg{i})
+		if i <= 2 && err != nil {
+			t.Errorf("Send %v failed: %v", i, err)
+		}
+		if i > 2 && err != ErrMailboxFull {
+			t.Errorf("Send %v returned %v", i, err)
+		}
+	}
+	drainGated(t, gate, out, []int{0, 1, 2})
+	ag.GracefulActiveShutdown()
+}
+
+func TestMailboxDropNewest(t *testing.T) {
+	ag, a, gate, out := setupGatedActor("TestMailboxDropNewest",
+		Mailbox{Capacity: 2, Policy: DropNewest})
+	for i := 1; i <= 4; i++ {
+		if err := a.Send(Msg{i}); err != nil {
+			t.Errorf("Send %v failed: %v", i, err)
+		}
+	}
+	if a.SendBlocking(Msg{5}) {
+		t.Errorf("SendBlocking() claimed a dropped message")
+	}
+	drainGated(t, gate, out, []int{0, 1, 2})
+	ag.GracefulActiveShutdown()
+}
+
+func TestMailboxDropOldest(t *testing.T) {
+	ag, a, gate, out := setupGatedActor("TestMailboxDropOldest",
+		Mailbox{Capacity: 2, Policy: DropOldest})
+	for i := 1; i <= 4; i++ {
+		if err := a.Send(Msg{i}); err != nil {
+			t.Errorf("Send %v failed: %v", i, err)
+		}
+	}
+	drainGated(t, gate, out, []int{0, 3, 4})
+	ag.GracefulActiveShutdown()
+}
+
+func TestMailboxBlock(t *testing.T) {
+	ag, a, gate, out := setupGatedActor("TestMailboxBlock",
+		Mailbox{Capacity: 1, Policy: Block})
+	a.Send(Msg{1})
+	sent := make(chan error)
+	go func() { sent <- a.Send(Msg{2}) }()
+	select {
+	case <-sent:
+		t.Errorf("Send() to a full mailbox did not block")
+	case <-time.After(5 * time.Millisecond):
+	}
+	close(gate)
+	if err := <-sent; err != nil {
+		t.Errorf("Blocked Send() failed: %v", err)
+	}
+	for _, e := range []int{0, 1, 2} {
+		if v := <-out; v != e {
+			t.Errorf("Expected %v, received %v", e, v)
+		}
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestSendToDeadActor(t *testing.T) {
+	ag := NewActorGroup("TestSendToDeadActor")
+	a := ag.NewActor(genDieOnInputActor())
+	a.SendBlocking(Msg{"die"})
+	ag.GracefulPassiveShutdown()
+	if err := a.Send(Msg{"again"}); err != ErrActorDead {
+		t.Errorf("Send() to a dead actor returned %v", err)
+	}
+}
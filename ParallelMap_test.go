@@ -0,0 +1,160 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowAtoi is strconv.Atoi, taking longer over earlier items, and
+// panicking on "panic".
+func slowAtoi(s string) (int, error) {
+	if s == "panic" {
+		panic("told to")
+	}
+	n, err := strconv.Atoi(s)
+	if err == nil {
+		time.Sleep(time.Duration(10-n) * time.Millisecond)
+	}
+	return n, err
+}
+
+func TestParallelMap(t *testing.T) {
+	ag := NewActorGroup("TestParallelMap")
+	in := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
+	seen := make([]bool, len(in))
+	for r := range ParallelMap(ag, slices.Values(in), slowAtoi, 4) {
+		if r.Err != nil || r.Value != r.Index || seen[r.Index] {
+			t.Errorf("Unexpected result %+v", r)
+			continue
+		}
+		seen[r.Index] = true
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("No result for item %v", i)
+		}
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestParallelMapOrdered(t *testing.T) {
+	ag := NewActorGroup("TestParallelMapOrdered")
+	in := []string{"0", "1", "x", "3", "panic", "5", "6"}
+	next := 0
+	for r := range ParallelMapOrdered(ag, slices.Values(in), slowAtoi, 3) {
+		if r.Index != next {
+			t.Errorf("Expected item %v, received %v", next, r.Index)
+		}
+		next = r.Index + 1
+		var pe *PanicError
+		switch in[r.Index] {
+		case "x":
+			if r.Err == nil {
+				t.Error("Expected an error for x")
+			}
+		case "panic":
+			if !errors.As(r.Err, &pe) || pe.Value != "told to" {
+				t.Errorf("Expected a PanicError, received %v", r.Err)
+			}
+		default:
+			if r.Err != nil || strconv.Itoa(r.Value) != in[r.Index] {
+				t.Errorf("Unexpected result %+v", r)
+			}
+		}
+	}
+	if next != len(in) {
+		t.Errorf("Only %v of %v results", next, len(in))
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestParallelMapStopsEarly(t *testing.T) {
+	ag := NewActorGroup("TestParallelMapStopsEarly")
+	count := 0
+	var taken atomic.Int32
+	forever := func(yield func(int) bool) {
+		for i := 0; yield(i); i++ {
+			taken.Add(1)
+		}
+	}
+	double := func(n int) (int, error) { return 2 * n, nil }
+	for range ParallelMap(ag, forever, double, 2) {
+		if count++; count == 5 {
+			// Those yielded, those worked on, waiting and with
+			// results not yet yielded, and one more being taken
+			if n := taken.Load(); n > 5+2*3+1 {
+				t.Errorf("Took %v items for 5 results", n)
+			}
+			break
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := ag.Shutdown(ctx); err != nil {
+		t.Errorf("Farm not torn down: %v", err)
+	}
+}
+
+func TestParallelMapNotStarted(t *testing.T) {
+	ag := NewActorGroup("TestParallelMapNotStarted")
+	ag.GracefulActiveShutdown()
+	in := slices.Values([]string{"1", "2"})
+	expectNotStarted := func(results iter.Seq[MapResult[int]]) {
+		rs := slices.Collect(results)
+		if len(rs) != 1 || rs[0].Index != -1 || rs[0].Err != ErrActorDead {
+			t.Errorf("Expected a single ErrActorDead, received %+v", rs)
+		}
+	}
+	expectNotStarted(ParallelMap(ag, in, slowAtoi, 2))
+	expectNotStarted(ParallelMapOrdered(ag, in, slowAtoi, 2))
+}
+
+func TestParallelMapOrderedWindow(t *testing.T) {
+	ag := NewActorGroup("TestParallelMapOrderedWindow")
+	var taken atomic.Int32
+	forever := func(yield func(int) bool) {
+		for i := 0; yield(i); i++ {
+			taken.Add(1)
+		}
+	}
+	gate := make(chan tEmptyStruct)
+	slowFirst := func(n int) (int, error) {
+		if n == 0 {
+			<-gate
+		}
+		return n, nil
+	}
+	results := make(chan int)
+	go func() {
+		defer close(results)
+		for r := range ParallelMapOrdered(ag, forever, slowFirst, 2) {
+			if results <- r.Index; r.Index == 9 {
+				break
+			}
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// A window of 4*2, and one more being taken
+	if n := taken.Load(); n > 4*2+1 {
+		t.Errorf("Took %v items while the first was held up", n)
+	}
+	close(gate)
+	next := 0
+	for i := range results {
+		if i != next {
+			t.Errorf("Expected item %v, received %v", next, i)
+		}
+		next++
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := ag.Shutdown(ctx); err != nil {
+		t.Errorf("Farm not torn down: %v", err)
+	}
+}
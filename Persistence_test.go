@@ -0,0 +1,232 @@
+package actor
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type addEvent struct {
+	N int
+}
+
+func init() {
+	gob.Register(addEvent{})
+}
+
+// A persistent counter.  An int adds to the total; "total" has
+// it reported; boom{} panics.
+func genCounterOptions(j Journal, every int, out chan int) *ActorOptions {
+	total := 0
+	apply := func(event interface{}) {
+		total += event.(addEvent).N
+	}
+	return &ActorOptions{
+		Receive: func(msg Msg, env *ActorEnv) {
+			switch m := msg[0].(type) {
+			case int:
+				if err := env.Persist(addEvent{m}, apply); err != nil {
+					panic(err)
+				}
+			case string:
+				out <- total
+			case boom:
+				panic("boom")
+			}
+		},
+		Persistence: &Persistence{
+			Journal:       j,
+			Init:          func() { total = 0 },
+			Recover:       apply,
+			SnapshotEvery: every,
+			Snapshot:      func() interface{} { return total },
+			Restore:       func(state interface{}) { total = state.(int) },
+		},
+	}
+}
+
+// runCounter starts the counter "counter" in a fresh group, adds
+// each of adds, and returns the total reported.
+func runCounter(t *testing.T, j Journal, every int, adds ...int) int {
+	out := make(chan int, 1)
+	ag := NewActorGroup("TestPersistence")
+	a := ag.NewNamedOptionedActor("counter",
+		genCounterOptions(j, every, out))
+	if a == nil {
+		t.Fatal("Persistent actor was not created")
+	}
+	for _, n := range adds {
+		a.Send(Msg{n})
+	}
+	a.Send(Msg{"total"})
+	var total int
+	select {
+	case total = <-out:
+	case <-time.After(1 * time.Second):
+		t.Fatal("No total reported")
+	}
+	ag.GracefulActiveShutdown()
+	return total
+}
+
+func TestPersistentActorRecovers(t *testing.T) {
+	j, err := NewFileJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if total := runCounter(t, j, 0, 1, 2, 3); total != 6 {
+		t.Errorf("Expected 6, received %v", total)
+	}
+	if total := runCounter(t, j, 0, 4); total != 10 {
+		t.Errorf("Expected 10 after recovery, received %v", total)
+	}
+}
+
+func TestPersistentActorSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	j, err := NewFileJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	runCounter(t, j, 3, 1, 2, 3, 4)
+	seq, state, ok, err := j.LoadSnapshot("TestPersistence:counter")
+	if err != nil || !ok || seq != 3 || state != 6 {
+		t.Errorf("Unexpected snapshot %v %v %v %v", seq, state, ok, err)
+	}
+	// Only the event after the snapshot should be replayed
+	replayed := 0
+	j.Replay("TestPersistence:counter", seq+1,
+		func(seq uint64, event interface{}) { replayed++ })
+	if replayed != 1 {
+		t.Errorf("Expected 1 event after the snapshot, found %v",
+			replayed)
+	}
+	if total := runCounter(t, j, 3, 5); total != 15 {
+		t.Errorf("Expected 15 after recovery, received %v", total)
+	}
+}
+
+func TestPersistentActorRestarts(t *testing.T) {
+	j, err := NewFileJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	out := make(chan int, 100)
+	kids := make(chan *Actor, 1)
+	ag := NewActorGroup("TestPersistentActorRestarts")
+	sup := ag.NewOptionedActor(&ActorOptions{
+		Supervisor: OneForOne{MaxRestarts: 5},
+		Receive: func(msg Msg, env *ActorEnv) {
+			if aO, ok := msg[0].(*ActorOptions); ok {
+				kids <- env.NewNamedOptionedActor("counter", aO)
+				return
+			}
+			env.This.SendByName("counter", msg)
+		},
+	})
+	sup.Send(Msg{genCounterOptions(j, 0, out)})
+	notice := deathNotice(<-kids)
+	for _, m := range []interface{}{1, 2, 3, boom{}} {
+		sup.Send(Msg{m})
+	}
+	<-notice
+	// Asked until the restarted counter is there to answer
+	deadline := time.After(1 * time.Second)
+	for total := -1; total == -1; {
+		sup.Send(Msg{"total"})
+		select {
+		case total = <-out:
+			if total != 6 {
+				t.Errorf("Expected 6 after restart, received %v", total)
+			}
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("No total reported")
+		}
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestPersistenceNeedsInit(t *testing.T) {
+	j, err := NewFileJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	aO := genCounterOptions(j, 0, nil)
+	aO.Persistence.Init = nil
+	ag := NewActorGroup("TestPersistenceNeedsInit")
+	if a := ag.NewOptionedActor(aO); a != nil {
+		t.Error("Persistent actor created without an Init")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestFileJournalSegments(t *testing.T) {
+	dir := t.TempDir()
+	j := &FileJournal{Dir: dir, SegmentSize: 64}
+	for i := uint64(1); i <= 20; i++ {
+		if err := j.Append("id", i, addEvent{int(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+	names, _ := filepath.Glob(filepath.Join(dir, "id", "*.seg"))
+	if len(names) < 2 {
+		t.Errorf("Expected several segments, found %v", len(names))
+	}
+	// A torn record at the end is ignored, then overwritten
+	last := names[len(names)-1]
+	f, _ := os.OpenFile(last, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0, 0, 0, 99, 1, 2})
+	f.Close()
+	j = &FileJournal{Dir: dir, SegmentSize: 64}
+	if err := j.Append("id", 21, addEvent{21}); err != nil {
+		t.Fatal(err)
+	}
+	var next uint64 = 5
+	err := j.Replay("id", 5, func(seq uint64, event interface{}) {
+		if seq != next || event.(addEvent).N != int(seq) {
+			t.Errorf("Expected event %v, received %v: %v", next,
+				seq, event)
+		}
+		next++
+	})
+	if err != nil || next != 22 {
+		t.Errorf("Replay stopped at %v: %v", next, err)
+	}
+	j.Close()
+}
+
+func TestFileJournalOpenSegments(t *testing.T) {
+	j := &FileJournal{Dir: t.TempDir(), MaxOpenSegments: 4}
+	defer j.Close()
+	for seq := uint64(1); seq <= 3; seq++ {
+		for i := 0; i < 20; i++ {
+			id := strconv.Itoa(i)
+			if err := j.Append(id, seq, addEvent{i}); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(j.segments); n > 4 {
+				t.Fatalf("%v segments open", n)
+			}
+		}
+	}
+	for i := 0; i < 20; i++ {
+		var seqs []uint64
+		err := j.Replay(strconv.Itoa(i), 1,
+			func(seq uint64, event interface{}) {
+				seqs = append(seqs, seq)
+			})
+		if err != nil || !slices.Equal(seqs, []uint64{1, 2, 3}) {
+			t.Errorf("ID %v replayed %v: %v", i, seqs, err)
+		}
+	}
+}
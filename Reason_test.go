@@ -0,0 +1,127 @@
+package actor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// obitCatcher is a watcher passing along each Obit.
+type obitCatcher chan Obit
+
+func (oc obitCatcher) obit(deceased *Actor, fname string, reason Reason) {
+	oc <- Obit{deceased, fname, reason}
+}
+
+func expectReason(t *testing.T, oc obitCatcher, kind ReasonKind) Reason {
+	select {
+	case o := <-oc:
+		if o.Reason.Kind != kind {
+			t.Errorf("%s died %v, expected %v", o.Fname, o.Reason, kind)
+		}
+		return o.Reason
+	case <-time.After(1 * time.Second):
+		t.Errorf("No obit, expected %v", kind)
+	}
+	return Reason{}
+}
+
+func TestReasonNormal(t *testing.T) {
+	oc := make(obitCatcher, 1)
+	ag := NewActorGroup("TestReasonNormal")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {})
+	a.watch(oc)
+	a.Die()
+	expectReason(t, oc, Normal)
+	ag.GracefulActiveShutdown()
+}
+
+func TestReasonAgedOut(t *testing.T) {
+	oc := make(obitCatcher, 1)
+	ag := NewActorGroup("TestReasonAgedOut")
+	a := ag.NewOptionedActor(&ActorOptions{
+		Receive: func(msg Msg, env *ActorEnv) {},
+		AgeOut:  10 * time.Millisecond,
+	})
+	a.watch(oc)
+	expectReason(t, oc, AgedOut)
+	ag.GracefulActiveShutdown()
+}
+
+func TestReasonShutdown(t *testing.T) {
+	oc := make(obitCatcher, 2)
+	kids := make(chan *Actor, 1)
+	ag := NewActorGroup("TestReasonShutdown")
+	parent := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		kids <- env.NewActor(func(msg Msg, env *ActorEnv) {})
+	})
+	parent.Send(Msg{"spawn"})
+	kid := <-kids
+	kid.watch(oc)
+	parent.Die()
+	expectReason(t, oc, Shutdown)
+	ag.GracefulActiveShutdown()
+}
+
+func TestReasonExit(t *testing.T) {
+	oc := make(obitCatcher, 1)
+	ag := NewActorGroup("TestReasonExit")
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		env.Exit("fed up")
+	})
+	a.watch(oc)
+	a.Send(Msg{"go"})
+	r := expectReason(t, oc, Exited)
+	if r.Value != "fed up" || !r.Abnormal() {
+		t.Errorf("Unexpected reason %v", r)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestReasonPanic(t *testing.T) {
+	births := make(chan string, 10)
+	died := make(chan ChildDied, 10)
+	oc := make(obitCatcher, 1)
+	ag := NewActorGroup("TestReasonPanic")
+	sup := ag.NewOptionedActor(genSupervisor(OneForOne{MaxRestarts: 5},
+		births, died))
+	sup.Send(Msg{[]string{"kid"}})
+	collectBirths(t, births, 1)
+	sup.env.findChild("kid").watch(oc)
+	sup.Send(Msg{boom{}, "kid"})
+	r := expectReason(t, oc, Panic)
+	if r.Value != "boom" {
+		t.Errorf("Expected panic value boom, received %v", r.Value)
+	}
+	if !bytes.Contains(r.Stack, []byte("panic")) {
+		t.Errorf("Stack trace missing: %s", r.Stack)
+	}
+	collectBirths(t, births, 1)
+	ag.GracefulActiveShutdown()
+}
+
+func TestChildDiedStack(t *testing.T) {
+	died := make(chan ChildDied, 1)
+	ag := NewActorGroup("TestChildDiedStack")
+	parent := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		switch m := msg[0].(type) {
+		case ChildDied:
+			died <- m
+		default:
+			env.NewActor(func(msg Msg, env *ActorEnv) {
+				panic("boom")
+			}).Send(Msg{"go"})
+		}
+	})
+	parent.Send(Msg{"spawn"})
+	select {
+	case cd := <-died:
+		if cd.Err != "boom" || len(cd.Stack) == 0 {
+			t.Errorf("Unexpected ChildDied %v, stack %q", cd.Err,
+				cd.Stack)
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("No ChildDied")
+	}
+	ag.GracefulActiveShutdown()
+}
@@ -0,0 +1,96 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+// Reports the time of every ReceiveTimeout{}.  "cancel" turns
+// them off, and any other message is simply taken in.
+func genIdleReporter(out chan time.Time) Receive {
+	return func(msg Msg, env *ActorEnv) {
+		switch msg[0].(type) {
+		case ReceiveTimeout:
+			out <- time.Now()
+		case string:
+			if msg[0] == "cancel" {
+				env.CancelReceiveTimeout()
+			} else if msg[0] == "set" {
+				env.SetReceiveTimeout(20 * time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestReceiveTimeoutOption(t *testing.T) {
+	out := make(chan time.Time, 10)
+	ag := NewActorGroup("TestReceiveTimeoutOption")
+	start := time.Now()
+	ag.NewOptionedActor(&ActorOptions{
+		Receive:        genIdleReporter(out),
+		ReceiveTimeout: 20 * time.Millisecond,
+	})
+	select {
+	case at := <-out:
+		if at.Sub(start) < 20*time.Millisecond {
+			t.Errorf("ReceiveTimeout after only %v", at.Sub(start))
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Never received a ReceiveTimeout")
+	}
+	// Still idle, so it comes again
+	select {
+	case <-out:
+	case <-time.After(1 * time.Second):
+		t.Error("ReceiveTimeout was not repeated")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestReceiveTimeoutReset(t *testing.T) {
+	out := make(chan time.Time, 10)
+	ag := NewActorGroup("TestReceiveTimeoutReset")
+	a := ag.NewOptionedActor(&ActorOptions{
+		Receive:        genIdleReporter(out),
+		ReceiveTimeout: 100 * time.Millisecond,
+	})
+	var last time.Time
+	for i := 0; i < 10; i++ {
+		a.Send(Msg{"busy"})
+		last = time.Now()
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case at := <-out:
+		if at.Sub(last) < 80*time.Millisecond {
+			t.Errorf("ReceiveTimeout %v after the last message",
+				at.Sub(last))
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Never received a ReceiveTimeout")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestReceiveTimeoutCancel(t *testing.T) {
+	out := make(chan time.Time, 10)
+	ag := NewActorGroup("TestReceiveTimeoutCancel")
+	a := ag.NewActor(genIdleReporter(out))
+	a.Send(Msg{"set"})
+	select {
+	case <-out:
+	case <-time.After(1 * time.Second):
+		t.Error("SetReceiveTimeout() had no effect")
+	}
+	a.Send(Msg{"cancel"})
+	time.Sleep(50 * time.Millisecond)
+	for len(out) > 0 {
+		<-out
+	}
+	select {
+	case <-out:
+		t.Error("ReceiveTimeout after CancelReceiveTimeout()")
+	case <-time.After(100 * time.Millisecond):
+	}
+	ag.GracefulActiveShutdown()
+}
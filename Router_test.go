@@ -0,0 +1,209 @@
+package actor
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// genTaggedRoutees returns a generator of routees which report
+// their own number, and the message, on out.  A bool panics.
+func genTaggedRoutees(out chan string) ReceiveGenerator {
+	n := 0
+	return func() Receive {
+		n++
+		tag := strconv.Itoa(n)
+		return func(msg Msg, env *ActorEnv) {
+			switch m := msg[0].(type) {
+			case string:
+				out <- tag + ":" + m
+			case int:
+				env.Reply(Msg{tag})
+			case bool:
+				panic("routee " + tag)
+			default:
+				out <- tag + ":" + reflect.TypeOf(m).String()
+			}
+		}
+	}
+}
+
+func getRoutees(t *testing.T, r *Actor) []*Actor {
+	v, err := r.Ask(Msg{GetRoutees{}}, 1*time.Second).Get()
+	if err != nil {
+		t.Fatalf("GetRoutees failed: %v", err)
+	}
+	return v[0].([]*Actor)
+}
+
+func TestRouterRoundRobin(t *testing.T) {
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestRouterRoundRobin")
+	r := ag.NewRouter(&RouterOptions{
+		Routing: RoundRobin,
+		Spawn:   genTaggedRoutees(out),
+		Size:    3,
+	})
+	for i := 0; i < 3; i++ {
+		r.Send(Msg{"m"})
+		// One at a time, to keep the reports in order
+		select {
+		case s := <-out:
+			if s != strconv.Itoa(i+1)+":m" {
+				t.Errorf("Message %v went to %v", i, s)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("Message not routed")
+		}
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestRouterBroadcast(t *testing.T) {
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestRouterBroadcast")
+	r := ag.NewRouter(&RouterOptions{
+		Routing: Broadcast,
+		Spawn:   genTaggedRoutees(out),
+		Size:    3,
+	})
+	r.Send(Msg{"all"})
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case s := <-out:
+			seen[s] = true
+		case <-time.After(1 * time.Second):
+			t.Fatal("Broadcast did not reach every routee")
+		}
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected 3 distinct routees, saw %v", seen)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestRouterConsistentHash(t *testing.T) {
+	ag := NewActorGroup("TestRouterConsistentHash")
+	r := ag.NewRouter(&RouterOptions{
+		Routing: ConsistentHash,
+		Spawn:   genTaggedRoutees(nil),
+		Size:    4,
+		HashKey: func(msg Msg) string {
+			return strconv.Itoa(msg[0].(int) % 10)
+		},
+	})
+	owner := map[int]string{}
+	for i := 0; i < 50; i++ {
+		v, err := r.Ask(Msg{i}, 1*time.Second).Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag := v[0].(string)
+		if o, ok := owner[i%10]; ok && o != tag {
+			t.Errorf("Key %v went to both %v and %v", i%10, o, tag)
+		}
+		owner[i%10] = tag
+	}
+	if r := ag.NewRouter(&RouterOptions{Routing: ConsistentHash}); r != nil {
+		t.Error("ConsistentHash router created without a HashKey")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestRouterSmallestMailbox(t *testing.T) {
+	out := make(chan string, 10)
+	release := make(chan bool)
+	ag := NewActorGroup("TestRouterSmallestMailbox")
+	busy := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		<-release
+	})
+	idle := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		out <- "idle"
+	})
+	busy.Send(Msg{"wedge"})
+	busy.Send(Msg{"queued"})
+	r := ag.NewRouter(&RouterOptions{
+		Routing: SmallestMailbox,
+		Routees: []*Actor{busy, idle},
+	})
+	r.Send(Msg{"m"})
+	expectEvents(t, out, "idle")
+	close(release)
+	ag.GracefulActiveShutdown()
+}
+
+func TestRouterResizeAndDeath(t *testing.T) {
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestRouterResizeAndDeath")
+	r := ag.NewRouter(&RouterOptions{
+		Routing: Random,
+		Spawn:   genTaggedRoutees(out),
+		Size:    2,
+	})
+	routees := getRoutees(t, r)
+	if len(routees) != 2 {
+		t.Fatalf("Expected 2 routees, found %v", len(routees))
+	}
+	notice := deathNotice(routees[0])
+	routees[0].Die()
+	<-notice
+	deadline := time.Now().Add(1 * time.Second)
+	for len(getRoutees(t, r)) != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := len(getRoutees(t, r)); n != 1 {
+		t.Errorf("Dead routee not removed, %v remain", n)
+	}
+	r.Send(Msg{ResizePool{4}})
+	if n := len(getRoutees(t, r)); n != 4 {
+		t.Errorf("Expected 4 routees after resize, found %v", n)
+	}
+	r.Send(Msg{ResizePool{1}})
+	if n := len(getRoutees(t, r)); n != 1 {
+		t.Errorf("Expected 1 routee after resize, found %v", n)
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestRouterReplacesPanicked(t *testing.T) {
+	out := make(chan string, 10)
+	ag := NewActorGroup("TestRouterReplacesPanicked")
+	r := ag.NewRouter(&RouterOptions{
+		Routing: RoundRobin,
+		Spawn:   genTaggedRoutees(out),
+		Size:    2,
+	})
+	panicked := getRoutees(t, r)[0]
+	notice := deathNotice(panicked)
+	r.Send(Msg{true})
+	select {
+	case <-notice:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Panicked routee not stopped")
+	}
+	for i := 0; i < 4; i++ {
+		r.Send(Msg{"m"})
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case s := <-out:
+			if s != "2:m" && s != "3:m" {
+				t.Errorf("Unexpected report %v", s)
+			}
+		case <-time.After(1 * time.Second):
+			t.Fatal("Message not routed")
+		}
+	}
+	routees := getRoutees(t, r)
+	if len(routees) != 2 {
+		t.Errorf("Expected 2 routees, found %v", len(routees))
+	}
+	for _, a := range routees {
+		if a == panicked {
+			t.Error("Panicked routee kept")
+		}
+	}
+	ag.GracefulActiveShutdown()
+}
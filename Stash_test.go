@@ -0,0 +1,106 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+// Until told "ready", the actor stashes everything.  After that
+// it reports the ints it is sent.
+func genStashingActor(out chan int, errs chan error) Receive {
+	working := func(msg Msg, env *ActorEnv) {
+		if v, ok := msg[0].(int); ok {
+			out <- v
+		}
+	}
+	return func(msg Msg, env *ActorEnv) {
+		if msg[0] == "ready" {
+			env.Become(working)
+			env.UnstashAll()
+			return
+		}
+		if err := env.Stash(); err != nil {
+			errs <- err
+		}
+	}
+}
+
+func TestStashUnstash(t *testing.T) {
+	out := make(chan int, 10)
+	errs := make(chan error, 10)
+	ag := NewActorGroup("TestStashUnstash")
+	a := ag.NewActor(genStashingActor(out, errs))
+	for _, m := range []interface{}{1, 2, 3, "ready", 4, 5} {
+		a.Send(Msg{m})
+	}
+	for i := 1; i <= 5; i++ {
+		if v := <-out; v != i {
+			t.Errorf("Expected %v, received %v", i, v)
+		}
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestStashCapacity(t *testing.T) {
+	out := make(chan int, 10)
+	errs := make(chan error, 10)
+	ag := NewActorGroup("TestStashCapacity")
+	a := ag.NewOptionedActor(&ActorOptions{
+		Receive:       genStashingActor(out, errs),
+		StashCapacity: 2,
+	})
+	for _, m := range []interface{}{1, 2, 3, "ready"} {
+		a.Send(Msg{m})
+	}
+	if err := <-errs; err != ErrStashFull {
+		t.Errorf("Expected ErrStashFull, received %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		if v := <-out; v != i {
+			t.Errorf("Expected %v, received %v", i, v)
+		}
+	}
+	ag.GracefulActiveShutdown()
+}
+
+// A Receive left running by Kill() may still stash, and unstash,
+// as its actor dies.  Run with -race.
+func TestStashAfterKill(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	errs := make(chan error, 10)
+	out := make(chan DeadLetter, 10)
+	ag := NewActorGroup("TestStashAfterKill")
+	ag.SubscribeDeadLetters(ag.NewActor(genDeadLetterCollector(out)))
+	a := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		if msg[0] != "wedge" {
+			errs <- env.Stash()
+			return
+		}
+		started <- true
+		<-release
+		errs <- env.Stash()
+		env.UnstashAll()
+	})
+	a.Send(Msg{"stashed"})
+	if err := <-errs; err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	a.Send(Msg{"wedge"})
+	<-started
+	oc := make(obitCatcher, 1)
+	a.watch(oc)
+	a.Kill()
+	expectReason(t, oc, Killed)
+	close(release)
+	select {
+	case err := <-errs:
+		if err != ErrActorDead {
+			t.Errorf("Expected ErrActorDead, received %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Receive never finished")
+	}
+	expectDeadLetter(t, out, "stashed", ErrActorDead)
+	ag.GracefulActiveShutdown()
+}
@@ -0,0 +1,194 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+type boom struct{}
+
+// Children announce each birth on the channel given, and panic
+// when sent boom{}
+func genFragileChild(births chan string) func(string) *ActorOptions {
+	return func(name string) *ActorOptions {
+		return &ActorOptions{
+			Receive: func(msg Msg, env *ActorEnv) {
+				switch msg[0].(type) {
+				case boom:
+					panic("boom")
+				case string:
+					births <- env.This.Id
+				}
+			},
+			FirstMessage: Msg{"born"},
+		}
+	}
+}
+
+// The supervisor creates its children when told their names, and
+// passes ChildDied along to died when it is not handling them.
+func genSupervisor(s SupervisorStrategy, births chan string,
+	died chan ChildDied) *ActorOptions {
+
+	child := genFragileChild(births)
+	return &ActorOptions{
+		Supervisor: s,
+		Receive: func(msg Msg, env *ActorEnv) {
+			switch m := msg[0].(type) {
+			case []string:
+				for _, n := range m {
+					env.NewNamedOptionedActor(n, child(n))
+				}
+			case ChildDied:
+				died <- m
+			case boom:
+				env.This.SendByName(msg[1].(string), Msg{boom{}})
+			}
+		},
+	}
+}
+
+func collectBirths(t *testing.T, births chan string,
+	n int) map[string]int {
+
+	seen := make(map[string]int)
+	for i := 0; i < n; i++ {
+		select {
+		case b := <-births:
+			seen[b]++
+		case <-time.After(time.Second):
+			t.Fatalf("Only %v of %v births seen", i, n)
+		}
+	}
+	return seen
+}
+
+func runSupervisorTest(t *testing.T, s SupervisorStrategy,
+	failed string, expected []string) {
+
+	births := make(chan string, 10)
+	died := make(chan ChildDied, 10)
+	ag := NewActorGroup("TestSupervisor")
+	sup := ag.NewOptionedActor(genSupervisor(s, births, died))
+	sup.Send(Msg{[]string{"a", "b", "c"}})
+	collectBirths(t, births, 3)
+	sup.Send(Msg{boom{}, failed})
+	seen := collectBirths(t, births, len(expected))
+	for _, n := range expected {
+		if seen[n] != 1 {
+			t.Errorf("%v restarted %v times", n, seen[n])
+		}
+	}
+	select {
+	case b := <-births:
+		t.Errorf("Unexpected restart of %v", b)
+	case m := <-died:
+		t.Errorf("ChildDied was not handled: %#v", m)
+	case <-time.After(10 * time.Millisecond):
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestOneForOne(t *testing.T) {
+	runSupervisorTest(t, OneForOne{MaxRestarts: 1}, "b",
+		[]string{"b"})
+}
+
+func TestOneForAll(t *testing.T) {
+	runSupervisorTest(t, OneForAll{MaxRestarts: 1}, "b",
+		[]string{"a", "b", "c"})
+}
+
+func TestRestForOne(t *testing.T) {
+	runSupervisorTest(t, RestForOne{MaxRestarts: 1}, "b",
+		[]string{"b", "c"})
+}
+
+func TestSupervisorEscalates(t *testing.T) {
+	births := make(chan string, 10)
+	died := make(chan ChildDied, 10)
+	ag := NewActorGroup("TestSupervisorEscalates")
+	top := ag.NewActor(func(msg Msg, env *ActorEnv) {
+		switch m := msg[0].(type) {
+		case ChildDied:
+			died <- m
+		case *ActorOptions:
+			sup := env.NewNamedOptionedActor("sup", m)
+			sup.Send(Msg{[]string{"a"}})
+		}
+	})
+	top.Send(Msg{genSupervisor(OneForOne{MaxRestarts: 1,
+		Within: time.Minute}, births, nil)})
+	collectBirths(t, births, 1)
+	top.SendByName("sup", Msg{boom{}, "a"})
+	collectBirths(t, births, 1)
+	top.SendByName("sup", Msg{boom{}, "a"})
+	select {
+	case m := <-died:
+		if m.Err != ErrTooManyRestarts || m.A.Id != "sup" {
+			t.Errorf("Unexpected escalation %#v", m)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Supervisor did not escalate")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := &Backoff{MinDelay: time.Millisecond,
+		MaxDelay: 5 * time.Millisecond}
+	for i, expected := range []time.Duration{1, 2, 4, 5, 5} {
+		if d := b.delay(i); d != expected*time.Millisecond {
+			t.Errorf("Attempt %v waited %v", i, d)
+		}
+	}
+	b.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := b.delay(0)
+		if d < time.Millisecond || d > 3*time.Millisecond/2 {
+			t.Errorf("Jittered delay %v out of range", d)
+		}
+	}
+}
+
+func TestBackoffRestartBuffers(t *testing.T) {
+	births := make(chan string, 10)
+	ag := NewActorGroup("TestBackoffRestartBuffers")
+	aO := genSupervisor(OneForOne{MaxRestarts: 5}, births, nil)
+	aO.Backoff = &Backoff{MinDelay: 20 * time.Millisecond}
+	sup := ag.NewOptionedActor(aO)
+	sup.Send(Msg{[]string{"a"}})
+	collectBirths(t, births, 1)
+	start := time.Now()
+	sup.SendBlocking(Msg{boom{}, "a"})
+	time.Sleep(5 * time.Millisecond)
+	if !sup.SendByName("a", Msg{"held"}) {
+		t.Errorf("Restarting child was not found by name")
+	}
+	// One birth announcement from FirstMessage, one from "held"
+	collectBirths(t, births, 2)
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Child restarted before backoff elapsed")
+	}
+	ag.GracefulActiveShutdown()
+}
+
+func TestBackoffKeepsName(t *testing.T) {
+	births := make(chan string, 10)
+	ag := NewActorGroup("TestBackoffKeepsName")
+	aO := genSupervisor(OneForOne{MaxRestarts: 5}, births, nil)
+	aO.Backoff = &Backoff{MinDelay: 50 * time.Millisecond}
+	sup := ag.NewOptionedActor(aO)
+	sup.Send(Msg{[]string{"a"}})
+	collectBirths(t, births, 1)
+	sup.SendBlocking(Msg{boom{}, "a"})
+	time.Sleep(10 * time.Millisecond)
+	if a := sup.env.NewNamedActor("a", func(Msg, *ActorEnv) {}); a != nil {
+		t.Error("Restarting child's name taken")
+	}
+	collectBirths(t, births, 1)
+	if a := sup.env.findChild("a"); a == nil || a.spec.options == nil {
+		t.Errorf("Child not restarted, found %v", a)
+	}
+	ag.GracefulActiveShutdown()
+}
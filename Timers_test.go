@@ -0,0 +1,128 @@
+package actor
+
+import (
+	"testing"
+	"time"
+)
+
+// Passes along anything it is sent, and runs timer commands
+// sent to it as funcs.
+func genTimerActor(out chan Msg) Receive {
+	return func(msg Msg, env *ActorEnv) {
+		if f, ok := msg[0].(func(*ActorEnv)); ok {
+			f(env)
+			return
+		}
+		out <- msg
+	}
+}
+
+func expectNoMsg(t *testing.T, out chan Msg, d time.Duration) {
+	select {
+	case m := <-out:
+		t.Errorf("Unexpected message %v", m)
+	case <-time.After(d):
+	}
+}
+
+func TestSendAfter(t *testing.T) {
+	out := make(chan Msg, 10)
+	ag := NewActorGroup("TestSendAfter")
+	a := ag.NewActor(genTimerActor(out))
+	start := time.Now()
+	a.Send(Msg{func(env *ActorEnv) {
+		env.SendAfter(30*time.Millisecond, Msg{"later"})
+	}})
+	select {
+	case m := <-out:
+		if m[0] != "later" {
+			t.Errorf("Expected later, received %v", m[0])
+		}
+		if time.Since(start) < 30*time.Millisecond {
+			t.Errorf("SendAfter fired after only %v",
+				time.Since(start))
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("SendAfter never fired")
+	}
+	expectNoMsg(t, out, 60*time.Millisecond)
+	ag.GracefulActiveShutdown()
+}
+
+func TestSendEveryCancel(t *testing.T) {
+	out := make(chan Msg, 100)
+	refs := make(chan *TimerRef, 1)
+	ag := NewActorGroup("TestSendEveryCancel")
+	a := ag.NewActor(genTimerActor(out))
+	a.Send(Msg{func(env *ActorEnv) {
+		refs <- env.SendEvery(10*time.Millisecond, Msg{"tick"})
+	}})
+	ref := <-refs
+	for i := 0; i < 3; i++ {
+		select {
+		case <-out:
+		case <-time.After(1 * time.Second):
+			t.Fatal("SendEvery stopped ticking")
+		}
+	}
+	if !ref.Cancel() {
+		t.Error("Cancel() of a running timer returned false")
+	}
+	if ref.Cancel() {
+		t.Error("Second Cancel() returned true")
+	}
+	time.Sleep(20 * time.Millisecond)
+	for len(out) > 0 {
+		<-out
+	}
+	expectNoMsg(t, out, 50*time.Millisecond)
+	ag.GracefulActiveShutdown()
+}
+
+func TestKeyedTimerReplaced(t *testing.T) {
+	out := make(chan Msg, 10)
+	ag := NewActorGroup("TestKeyedTimerReplaced")
+	a := ag.NewActor(genTimerActor(out))
+	a.Send(Msg{func(env *ActorEnv) {
+		env.SendAfterKeyed("k", 30*time.Millisecond, Msg{"first"})
+		env.SendAfterKeyed("k", 60*time.Millisecond, Msg{"second"})
+		env.SendAfterKeyed("gone", 30*time.Millisecond, Msg{"gone"})
+		if !env.CancelTimer("gone") {
+			t.Error("CancelTimer() did not find its timer")
+		}
+		if env.CancelTimer("nothing") {
+			t.Error("CancelTimer() found a timer never set")
+		}
+	}})
+	select {
+	case m := <-out:
+		if m[0] != "second" {
+			t.Errorf("Expected second, received %v", m[0])
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Keyed timer never fired")
+	}
+	expectNoMsg(t, out, 60*time.Millisecond)
+	ag.GracefulActiveShutdown()
+}
+
+func TestTimersCanceledOnDeath(t *testing.T) {
+	out := make(chan Msg, 100)
+	refs := make(chan *TimerRef, 1)
+	ag := NewActorGroup("TestTimersCanceledOnDeath")
+	a := ag.NewActor(genTimerActor(out))
+	a.Send(Msg{func(env *ActorEnv) {
+		refs <- env.SendEvery(5*time.Millisecond, Msg{"tick"})
+		env.SendAfter(50*time.Millisecond, Msg{"late"})
+	}})
+	ref := <-refs
+	<-out
+	notice := make(tDeathNotice)
+	a.watch(notice)
+	a.Die()
+	<-notice
+	if ref.Cancel() {
+		t.Error("Timer still running after death")
+	}
+	ag.GracefulPassiveShutdown()
+}
@@ -1,14 +1,22 @@
 package actor
 
+import (
+	"context"
+	"time"
+)
+
 type Actor struct {
 	Id        string
 	Group     *ActorGroup
 	env       *ActorEnv
 	parent    *Actor
-	watchers  map[*Actor]tEmptyStruct
+	watchers  map[tWatcher]tEmptyStruct
+	links     map[*Actor]tEmptyStruct
 	children  map[string]*Actor
+	order     []string // Children's names in order of birth
 	options   map[string]interface{}
 	validator func(Msg) bool
+	spec      tSpec // How to make this actor again
 }
 
 func (a *Actor) validateMsg(msg Msg) bool {
@@ -24,25 +32,133 @@ func (a *Actor) validateMsg(msg Msg) bool {
 }
 
 // Send propogates the message to the actor upon which the
-// function is called.  The function is guaranteed to return
-// immediately.
-func (a *Actor) Send(msg Msg) {
-	if a.validateMsg(msg) {
-		go func() {
-			defer errLogWithText(a, "Failure in Send()")
-			// TODO: Check for failure with a defer
-			a.env.mbox <- msg
-		}()
+// function is called.  Unless the actor has a bounded mailbox
+// with the Block policy, the function is guaranteed to return
+// immediately.  Messages sent by any one sender (whether an actor
+// or any other goroutine) are received in the order sent.
+//
+// The error returned reports whether the message was queued:
+// ErrMsgRejected if the validator refused it, ErrMailboxFull if
+// a Reject mailbox turned it away, or ErrActorDead if the actor
+// has stopped taking messages.  A message which is not queued
+// also goes to the group's dead letter office, except for one
+// discarded by a DropNewest mailbox, which is not reported
+// anywhere.
+func (a *Actor) Send(msg Msg) error {
+	err := a.send(msg)
+	if err == errDropped {
+		dlog(a, "mailbox full, dropped message")
+		return nil
+	}
+	if err == errDeadLettered {
+		return nil
+	}
+	return err
+}
+
+// SendCtx is Send(), except that when the actor has a bounded
+// mailbox with the Block policy, it gives up waiting for room
+// once ctx ends, returning ctx.Err().  A message given up on is
+// not sent to the dead letter office.
+func (a *Actor) SendCtx(ctx context.Context, msg Msg) error {
+	err := a.sendQueued(ctx, msg, msg)
+	if err == errDropped || err == errDeadLettered {
+		return nil
+	}
+	return err
+}
+
+// send is Send() with the internal errors left in.
+func (a *Actor) send(msg Msg) error {
+	return a.sendQueued(context.Background(), msg, msg)
+}
+
+// sendQueued validates msg, but queues it as wrapped in queued.
+func (a *Actor) sendQueued(ctx context.Context, msg Msg,
+	queued Msg) error {
+
+	err := a.enqueue(ctx, msg, queued)
+	if err != nil && err == ctx.Err() {
+		return err // Given up on, not undeliverable
+	}
+	a.undelivered(msg, err)
+	return err
+}
+
+// enqueue is sendQueued() without the dead letters.
+func (a *Actor) enqueue(ctx context.Context, msg Msg,
+	queued Msg) error {
+
+	if !a.validateMsg(msg) {
+		return ErrMsgRejected
 	}
+	return a.env.mbox.putCtx(ctx, queued, false)
 }
 
+// undelivered sends msg to the dead letter office if err from
+// enqueue() says it should go there.
+func (a *Actor) undelivered(msg Msg, err error) {
+	switch err {
+	case nil, errDropped:
+	case errDeadLettered:
+		a.Group.deadLetter(DeadLetter{msg, a, "", ErrMailboxFull})
+	default:
+		a.Group.deadLetter(DeadLetter{msg, a, "", err})
+	}
+}
+
+// Ask sends msg to the actor and returns a Future for its answer,
+// which the receiver provides by calling ActorEnv.Reply().  The
+// Future resolves to ErrActorDead if the actor dies before
+// replying, or to ErrTimeout once timeout has elapsed.  A timeout
+// of zero waits indefinitely.
+func (a *Actor) Ask(msg Msg, timeout time.Duration) *Future {
+	f := newFuture(a)
+	if !a.validateMsg(msg) {
+		f.resolve(nil, ErrMsgRejected)
+		return f
+	}
+	if !a.env.post(a.env.cbox, cAddWatcher{f}) {
+		f.resolve(nil, ErrActorDead)
+		return f
+	}
+	f.expireAfter(timeout)
+	if err := a.env.mbox.put(Msg{tAsk{f, msg}}, false); err != nil {
+		if err == errDropped || err == errDeadLettered {
+			err = ErrMailboxFull
+		}
+		f.resolve(nil, err)
+	}
+	return f
+}
+
+// SendByName sends msg to the child of a with the given name,
+// returning false if there is no such child.  A child which is
+// being restarted by its supervisor counts as existing; the
+// message is held for it according to the supervisor's
+// Backoff.Pending policy.  A message for a missing child goes
+// to the dead letter office.
 func (a *Actor) SendByName(name string, msg Msg) bool {
-	target := a.env.findChild(name)
-	if target == nil {
+	found := a.sendByName(name, msg)
+	if !found {
+		a.Group.deadLetter(DeadLetter{msg, nil,
+			a.fullName() + ":" + name, ErrNoSuchActor})
+	}
+	return found
+}
+
+// sendByName is SendByName() for callers with their own plans
+// for a missing child.
+func (a *Actor) sendByName(name string, msg Msg) bool {
+	resC := make(chan tChildRoute, 1)
+	if !a.env.post(a.env.cbox, cSendChild{name, msg, resC}) {
 		return false
 	}
-	target.Send(msg)
-	return true
+	route := <-resC
+	if route.a != nil {
+		route.a.Send(msg)
+	}
+	return route.found
 }
 
 // SendBlocking() adds the msg to the specified actor's inbox.
@@ -57,19 +173,7 @@ func (a *Actor) SendByName(name string, msg Msg) bool {
 // NOTE: Blocking operations should generally NOT be used with
 // the actor paradigm.  Using this could lead to deadlock.
 func (a *Actor) SendBlocking(msg Msg) bool {
-	valid := a.validateMsg(msg)
-	if !valid {
-		return false
-	}
-	retCode := true
-	defer func() {
-		if r := recover(); r != nil {
-			retCode = false
-		}
-	}()
-	a.env.mbox <- msg
-
-	return retCode
+	return a.send(msg) == nil
 }
 
 // Die() will cause an actor to gracefully die.  For details on
@@ -80,29 +184,55 @@ func (a *Actor) Die() {
 	a.env.Suicide()
 }
 
-// Monitor will cause the watcher to be notified when a dies
+// Kill ends an actor at once, without the cooperation of its
+// Receive.  Mail still queued goes to the dead letter office, the
+// actor's children are killed in turn, and watchers receive an
+// Obit with a Killed Reason.  A Receive which is running at the
+// time is abandoned: it cannot be stopped, but the actor no
+// longer waits for it, and nothing it asks of the actor
+// afterwards takes effect.  Like Die(), Kill returns
+// immediately.
+func (a *Actor) Kill() {
+	if !a.env.post(a.env.sbox, sAssassin{}) {
+		dlog(a, "is already dead")
+	}
+}
+
+// Monitor will cause the watcher to be notified when a dies.  If
+// a is already dead, the notice is sent straight away.
 func (a *Actor) Monitor(watcher *Actor) {
-	safeSend(a.env.cbox, cAddWatcher{watcher}, a, "actor.AddWatcher()")
+	a.watch(watcher)
 }
 
 // Unmonitor removes a previous monitor entry
 func (a *Actor) Unmonitor(watcher *Actor) {
-	safeSend(a.env.cbox, cDelWatcher{watcher}, a, "actor.DelWatcher()")
+	a.env.post(a.env.cbox, cDelWatcher{watcher})
+}
+
+func (a *Actor) watch(w tWatcher) {
+	if !a.env.post(a.env.cbox, cAddWatcher{w}) {
+		w.obit(a, a.fullName(), a.env.exitReason)
+	}
 }
 
 // a.obit() is called to notify a that deceased has terminated
-func (a *Actor) obit(deceased *Actor, fname string) {
+func (a *Actor) obit(deceased *Actor, fname string, reason Reason) {
 	// We don't care if this one fails
-	sendIgnoreErr(a.env.cbox, Obit{deceased, fname})
-	//safeSend(a.env.cbox, Obit{deceased, fname}, a, "actor.Obit()")
+	a.env.post(a.env.cbox, Obit{deceased, fname, reason})
 }
 
-// This is called exclusively from the env's loop
-func (a *Actor) killMyKids(resp chan bool) {
+// This is called exclusively from the env's loop, with a copy
+// of the children taken there.  With brutal set the children
+// are killed, rather than shut down.
+func (a *Actor) killMyKids(kids []*Actor, resp chan bool, brutal bool) {
 	dlog(a, "Entered")
 	defer errLog(a)
-	for _, k := range a.children {
-		k.Die()
+	for _, k := range kids {
+		if brutal {
+			k.Kill()
+		} else {
+			k.env.exit(Reason{Kind: Shutdown})
+		}
 	}
 	dlog(a, "Sending true")
 	resp <- true
@@ -110,14 +240,14 @@ func (a *Actor) killMyKids(resp chan bool) {
 }
 
 func (a *Actor) GoString() string {
-	if a.parent == nil {
+	if a.parent == nil && a.Id == _GUARDIAN {
 		return a.Group.Id + "(guard)"
 	}
 	return a.Id
 }
 
 func (a *Actor) getName() string {
-	if a.parent == nil {
+	if a.parent == nil && a.Id == _GUARDIAN {
 		return a.Group.Id
 	}
 	return a.Id
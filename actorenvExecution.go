@@ -1,9 +1,10 @@
 package actor
 
 import (
-	"github.com/hishboy/gocommons/lang"
 	"reflect"
 	"runtime"
+	"runtime/debug"
+	"time"
 )
 
 // Somewhat longer than ideal for a function, but it is the
@@ -14,8 +15,10 @@ func (env *ActorEnv) mainLoop() {
 	tombstone := false // Not accepting any more input
 	recRunning := true // Flipped at end of activate()
 	waitingOnKids := false
-	burried := make(chan bool, 1)
-	mqueue := lang.NewQueue()
+	killed := false // Receive is abandoned, not waited for
+	burried := make(chan bool, 2)
+	idle := &tIdleTimer{}
+	defer idle.disarm()
 	for !dead {
 		dlog(env, "dying = ", dying, " dead = ", dead, " tstone = ",
 			tombstone, " reR = ", recRunning, " wOK = ", waitingOnKids)
@@ -28,16 +31,38 @@ func (env *ActorEnv) mainLoop() {
 			case sReceiveFinished:
 				dlog(env, "Notified Received() completed")
 				recRunning = false
+			case sReceiveTimeout:
+				env.idleLimit = m.(sReceiveTimeout).d
+				idle.disarm()
 			case sAssassin:
-				dying = true
-				dead = true
-			case sHappyDeath:
+				dlog(env, "received sAssassin{}")
+				env.exitReason = Reason{Kind: Killed}
+				if !killed {
+					killed = true
+					dying = true
+					env.cancel()
+					env.mbox.close()
+					if env.dhook != nil {
+						select {
+						case env.dhook <- true:
+						default:
+						}
+					}
+					go env.This.killMyKids(env.childList(), burried, true)
+				}
+			case sHappyDeath, sExit:
 				dlog(env, "received HappyDeath{}")
 				if dying == false {
-					go func() {
-						dlog(env, "Sending self sTombstone{}")
-						env.mbox <- Msg{sTombstone{}}
-					}()
+					if e, ok := m.(sExit); ok {
+						env.exitReason = e.reason
+						env.forRestart = e.restart
+					}
+					env.cancel()
+					if env.lastMessage != nil {
+						env.mbox.put(env.lastMessage, true)
+					}
+					env.mbox.close()
+					tombstone = true
 					if env.dhook != nil {
 						env.dhook <- true
 					}
@@ -50,30 +75,34 @@ func (env *ActorEnv) mainLoop() {
 					"of type", m)
 				runtime.Goexit()
 			}
-		case m := <-env.mbox:
-			switch m[0].(type) {
-			case sTombstone:
-				dlog(env, "Received sTombstone{}")
-				tombstone = true
-			default:
-				mqueue.Push(m)
+		case <-env.mbox.ready:
+			// New mail, picked up below once Receive is free
+		case <-idle.c:
+			idle.c = nil
+			env.mbox.put(Msg{ReceiveTimeout{}}, true)
+		}
+		if !recRunning && !killed {
+			if zz, ok := env.nextMsg(dying); ok {
+				recRunning = true
+				env.runMsg(zz)
 			}
 		}
-		if !recRunning && mqueue.Len() > 0 {
-			recRunning = true
-			zz := mqueue.Poll().(Msg)
-			env.runMsg(zz)
+		if recRunning || dying || env.idleLimit <= 0 {
+			idle.disarm()
+		} else if idle.c == nil && env.mbox.len() == 0 {
+			idle.arm(env.idleLimit)
 		}
-		if tombstone && mqueue.Len() == 0 && !waitingOnKids {
+		if tombstone && !recRunning && env.mbox.len() == 0 &&
+			!waitingOnKids && !killed {
 			dlog(env, "Calling killMyKids()")
-			go env.This.killMyKids(burried)
+			go env.This.killMyKids(env.childList(), burried, false)
 			if len(env.This.children) > 0 {
 				waitingOnKids = true
 			} else {
 				dead = true
 			}
 		}
-		if waitingOnKids {
+		if waitingOnKids || killed {
 			if len(env.This.children) == 0 {
 				dlog(env, "waitingOnKids = true. All dead.  Setting false")
 				dead = true
@@ -85,13 +114,18 @@ func (env *ActorEnv) mainLoop() {
 		runtime.Gosched()
 	}
 	dlog(env, "Entering recRunning loop")
-	for recRunning {
-		msg := <-env.sbox
-		switch msg.(type) {
-		case sReceiveFinished:
-			recRunning = false
-		default:
-			//
+	for recRunning && !killed {
+		// Receive may still be asking things of us
+		select {
+		case m := <-env.cbox:
+			env.manageChildren(m, true)
+		case msg := <-env.sbox:
+			switch msg.(type) {
+			case sReceiveFinished:
+				recRunning = false
+			default:
+				//
+			}
 		}
 	}
 	dlog(env, "Waiting for burried")
@@ -106,32 +140,88 @@ func (env *ActorEnv) manageChildren(msg interface{}, dying bool) {
 	switch m := msg.(type) {
 	case cAddChild:
 		// Need to check that the name does not conflict.
-		if _, ok := env.This.children[m.id]; ok || dying {
-			// Actor already exists or instructed to make
-			// no more actors
+		_, ok := env.This.children[m.id]
+		_, kept := env.pending[m.id]
+		if ok || (kept && !m.restart) || dying {
+			// Actor already exists, is being restarted, or
+			// instructed to make no more actors
 			m.resp <- false
 		} else {
 			env.This.children[m.id] = m.a
+			env.This.order = append(env.This.order, m.id)
 			m.resp <- true
 		}
 	case Obit:
 		if env.msgObit {
-			env.This.Send(Msg{m})
+			env.mbox.put(Msg{m}, true)
 		} else if env.ohook != nil {
 			go func() { env.ohook <- m }()
 		} else {
 			dlog(env, " received an obit, but has no handler")
 		}
 	case cRemoveChild:
+		delete(env.restarting, env.This.children[m.id])
 		delete(env.This.children, m.id)
+		for i, n := range env.This.order {
+			if n == m.id {
+				env.This.order = append(env.This.order[:i],
+					env.This.order[i+1:]...)
+				break
+			}
+		}
 		m.ch <- true
 	case cFindMember:
 		child := env.This.children[m.fname]
 		m.resp <- child
+	case cGetChildren:
+		m.resp <- env.childList()
+	case cSendChild:
+		// The send itself is left to the caller, who may block
+		if held, ok := env.pending[m.id]; ok {
+			if env.holdPending() {
+				env.pending[m.id] = append(held, m.msg)
+			} else {
+				env.This.Group.deadLetter(DeadLetter{m.msg, nil,
+					env.This.fullName() + ":" + m.id, ErrActorDead})
+			}
+			m.resp <- tChildRoute{nil, true}
+		} else if child, ok := env.This.children[m.id]; ok {
+			m.resp <- tChildRoute{child, true}
+		} else {
+			m.resp <- tChildRoute{nil, false}
+		}
+	case cRestarted:
+		held := env.pending[m.id]
+		delete(env.pending, m.id)
+		if m.a == nil {
+			for _, msg := range held {
+				env.This.Group.deadLetter(DeadLetter{msg, nil,
+					env.This.fullName() + ":" + m.id, ErrActorDead})
+			}
+			break
+		}
+		if env.backoffs[m.id] != nil {
+			env.backoffs[m.id].started = time.Now()
+		}
+		// Held messages were accepted long ago, so the
+		// child's mailbox may not turn them away now.
+		for _, msg := range held {
+			m.a.env.mbox.put(msg, true)
+		}
 	case cAddWatcher:
 		env.This.watchers[m.a] = tEmptyStruct{}
 	case cDelWatcher:
 		delete(env.This.watchers, m.a)
+	case cLink:
+		if m.add {
+			env.linked(m.a)
+		} else {
+			delete(env.This.links, m.a)
+		}
+	case cTrapExits:
+		env.trapExits = m.val
+	case cExitSignal:
+		env.exitSignalled(m)
 	default:
 		elog(env, "received an unhandled message of type",
 			reflect.TypeOf(m))
@@ -140,6 +230,53 @@ func (env *ActorEnv) manageChildren(msg interface{}, dying bool) {
 	return
 }
 
+// tIdleTimer measures how long mainLoop() has sat idle, for
+// ActorOptions.ReceiveTimeout.  c is nil while it is not armed.
+type tIdleTimer struct {
+	t *time.Timer
+	c <-chan time.Time
+}
+
+func (it *tIdleTimer) arm(d time.Duration) {
+	it.t = time.NewTimer(d)
+	it.c = it.t.C
+}
+
+func (it *tIdleTimer) disarm() {
+	if it.t != nil {
+		it.t.Stop()
+	}
+	it.t = nil
+	it.c = nil
+}
+
+// childList is GetChildren() for use within mainLoop().
+func (env *ActorEnv) childList() []*Actor {
+	alist := make([]*Actor, 0)
+	for _, a := range env.This.children {
+		alist = append(alist, a)
+	}
+	return alist
+}
+
+// nextMsg takes the next message destined for Receive from the
+// mailbox.  Messages the framework deals with itself are handled
+// along the way.
+func (env *ActorEnv) nextMsg(dying bool) (Msg, bool) {
+	for {
+		m, ok := env.mbox.get()
+		if !ok {
+			return nil, false
+		}
+		if len(m) > 0 {
+			if cd, ok := m[0].(ChildDied); ok && env.supervise(cd, dying) {
+				continue
+			}
+		}
+		return m, true
+	}
+}
+
 func genDispatchFn(env *ActorEnv) func(msg Msg) {
 	return func(msg Msg) {
 		env.This.parent.Send(msg)
@@ -151,11 +288,24 @@ func (env *ActorEnv) runMsg(msg Msg) {
 		defer func() {
 			if r := recover(); r != nil {
 				dlog(env, "Child Died: ", r)
-				env.Return(Msg{ChildDied{r, env.This, msg}})
+				env.Return(Msg{ChildDied{r, env.This, msg,
+					debug.Stack()}})
 			}
 			dlog(env, "sReceiveFinished{} to")
-			env.sbox <- sReceiveFinished{}
+			// Fails if a Kill() did not wait for us
+			env.post(env.sbox, sReceiveFinished{})
 		}()
+		env.current = msg
+		env.envelope = Envelope{}
+		env.asker = nil
+		if e, ok := msg[0].(tEnvelope); ok {
+			env.envelope = e.e
+			msg = e.msg
+		}
+		if ask, ok := msg[0].(tAsk); ok {
+			env.asker = ask.f
+			msg = ask.msg
+		}
 		switch b := env.behavior.(type) {
 		case func(Msg, *ActorEnv):
 			b(msg, env)
@@ -163,6 +313,8 @@ func (env *ActorEnv) runMsg(msg Msg) {
 			b(msg, env)
 		case FarmReceive:
 			b(msg, env, genDispatchFn(env))
+		case ActorClass:
+			b.Receive(msg, env)
 		}
 	}()
 }
@@ -1,58 +1,202 @@
 package actor
 
-func newActorEnv(this *Actor, r interface{}) *ActorEnv {
+import (
+	"context"
+	"time"
+)
+
+// newActorEnv prepares an environment, which does not run until
+// activate() is called.  Everything set from aO is in place
+// before the actor can be seen by anyone else.
+func newActorEnv(this *Actor, r interface{},
+	aO *ActorOptions) *ActorEnv {
+
 	env := &ActorEnv{
 		This:     this,
 		behavior: r,
-		mbox:     make(chan Msg, _MBOX_SIZE),
+		mbox:     newMailbox(),
 		cbox:     make(chan interface{}, 5),
 		sbox:     make(chan interface{}, 5),
 	}
-	env.activate()
+	env.class, _ = r.(ActorClass)
+	env.ctx, env.cancel = context.WithCancel(context.Background())
+	if aO != nil {
+		env.supervisor = aO.Supervisor
+		env.backoff = aO.Backoff
+		env.lastMessage = aO.LastMessage
+		env.stashCap = aO.StashCapacity
+		env.idleLimit = aO.ReceiveTimeout
+		env.mbox.configure(aO.Mailbox)
+		// Queued before anyone can send, so it is the first
+		if aO.FirstMessage != nil {
+			env.mbox.put(aO.FirstMessage, true)
+		}
+	}
 	return env
 }
 
 func (env *ActorEnv) activate() {
+	if aO := env.This.spec.options; aO != nil && aO.AgeOut != 0 {
+		env.deathTimer = time.AfterFunc(aO.AgeOut, func() {
+			defer recover()
+			env.exit(Reason{Kind: AgedOut})
+		})
+	}
 	env.This.Group.swg.Add(1)
 	go func() {
 		defer env.die()
 		env.mainLoop()
 	}()
-	env.sbox <- sReceiveFinished{}
+	env.runStart()
 	dlog(env, "is active")
 	return
 }
 
 func (env *ActorEnv) die() {
-	// Non-Guardian actions only
-	if env.This.parent != nil {
-		ch := make(chan bool, 1)
-		safeSend(env.This.parent.env.cbox,
-			cRemoveChild{env.This.Id, ch},
-			env, "ActorEnv.die()")
-		<-ch
-		env.This.Group.removeMember(env.This.fullName())
-		env.This.Group.swg.Done()
-	}
+	env.cancel()
 	if env.deathTimer != nil {
 		env.deathTimer.Stop()
 	}
+	env.timers.stopAll()
+	env.mbox.close()
+	env.closeBoxes(func() {
+		// Non-Guardian actions only
+		if env.This.parent != nil {
+			ch := make(chan bool, 1)
+			if env.This.parent.env.post(env.This.parent.env.cbox,
+				cRemoveChild{env.This.Id, ch}) {
+				<-ch
+			} else {
+				elog(env, "parent died before its child")
+			}
+			env.This.Group.removeMember(env.This.fullName())
+		}
+		env.runStop()
+	})
+	if env.This.parent != nil {
+		env.This.Group.swg.Done()
+	}
 	// Notify anyone watching that we're gone
 	for a, _ := range env.This.watchers {
-		a.obit(env.This, env.This.fullName())
+		a.obit(env.This, env.This.fullName(), env.exitReason)
+	}
+	for a := range env.This.links {
+		a.exitSignal(env.This, env.exitReason)
+	}
+	// Anything left unread is dead letters.  Asks left unread
+	// have had their obit.
+	env.stashMu.Lock()
+	unread := env.stash
+	env.stash, env.stashShut = nil, true
+	env.stashMu.Unlock()
+	for m, ok := env.mbox.get(); ok; m, ok = env.mbox.get() {
+		unread = append(unread, m)
+	}
+	for _, m := range unread {
+		if len(m) > 0 {
+			if _, isAsk := m[0].(tAsk); isAsk {
+				continue
+			}
+			if e, ok := m[0].(tEnvelope); ok {
+				m = e.msg
+			}
+		}
+		env.This.Group.deadLetter(DeadLetter{m, env.This, "",
+			ErrActorDead})
 	}
-	close(env.mbox)
-	close(env.cbox)
-	close(env.sbox)
 	dlog(env, "has terminated")
 }
 
+// post delivers a control or state message to the actor's loop,
+// returning false if the actor has died.  The boxes are never
+// closed, as a send racing a close cannot be made safe.
+func (env *ActorEnv) post(box chan interface{}, msg interface{}) bool {
+	env.boxLock.RLock()
+	defer env.boxLock.RUnlock()
+	if env.boxesClosed {
+		return false
+	}
+	box <- msg
+	return true
+}
+
+// closed returns true once post() fails, when the actor has died
+// and the exitReason is settled.
+func (env *ActorEnv) closed() bool {
+	env.boxLock.RLock()
+	defer env.boxLock.RUnlock()
+	return env.boxesClosed
+}
+
+// closeBoxes makes all further post()s fail, once last() has
+// run.  Anything posted since mainLoop() ended is answered as the
+// dead would answer it.
+func (env *ActorEnv) closeBoxes(last func()) {
+	stop := make(chan tEmptyStruct)
+	drained := make(chan tEmptyStruct)
+	go func() {
+		// Unblocks posters holding the read lock
+		defer close(drained)
+		for {
+			select {
+			case m := <-env.cbox:
+				env.answerLate(m)
+			case <-env.sbox:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	last()
+	env.boxLock.Lock()
+	env.boxesClosed = true
+	env.boxLock.Unlock()
+	close(stop)
+	<-drained
+	for {
+		select {
+		case m := <-env.cbox:
+			env.answerLate(m)
+		case <-env.sbox:
+		default:
+			return
+		}
+	}
+}
+
+func (env *ActorEnv) answerLate(msg interface{}) {
+	switch m := msg.(type) {
+	case cAddWatcher:
+		// Sent its obit with the others by die()
+		env.This.watchers[m.a] = tEmptyStruct{}
+	case cDelWatcher:
+		delete(env.This.watchers, m.a)
+	case cLink:
+		if m.add {
+			env.This.links[m.a] = tEmptyStruct{}
+		} else {
+			delete(env.This.links, m.a)
+		}
+	case cAddChild:
+		m.resp <- false
+	case cFindMember:
+		m.resp <- nil
+	case cGetChildren:
+		m.resp <- make([]*Actor, 0)
+	case cSendChild:
+		m.resp <- tChildRoute{nil, false}
+	case cRemoveChild:
+		m.ch <- true
+	}
+}
+
 func (env *ActorEnv) newChildEnv(name string,
-	actor *Actor) bool {
+	actor *Actor, restart bool) bool {
 
 	resC := make(chan bool)
-	safeSend(env.cbox, cAddChild{name, actor, resC},
-		env.This, "actorEnv.newChild()")
+	if !env.post(env.cbox, cAddChild{name, actor, restart, resC}) {
+		return false
+	}
 	ok := <-resC
 	if !ok {
 		return false
@@ -65,31 +209,48 @@ func (env *ActorEnv) newChildEnv(name string,
 	return ok
 }
 
-func (env *ActorEnv) newChild(n string,
-	receive interface{}) (*Actor, bool) {
+// newChild creates and starts a child actor.  aO may be nil, in
+// which case the child has default options.
+// newChild creates and starts a child.  restart is given only by
+// a supervisor restarting a child of that name; see respawn().
+func (env *ActorEnv) newChild(n string, receive interface{},
+	aO *ActorOptions, restart bool) (*Actor, bool) {
 
 	child := &Actor{
 		Id:        n,
 		Group:     env.This.Group,
 		parent:    env.This,
 		validator: nil,
+		spec:      tSpec{receive, aO},
+	}
+	if aO != nil {
+		child.validator = aO.Validator
 	}
 	child.children = make(map[string]*Actor)
-	child.watchers = make(map[*Actor]tEmptyStruct)
+	child.watchers = make(map[tWatcher]tEmptyStruct)
+	child.links = make(map[*Actor]tEmptyStruct)
+	child.env = newActorEnv(child, receive, aO)
+	if aO != nil && aO.Persistence != nil {
+		if err := child.env.recoverState(aO.Persistence); err != nil {
+			elog(env, "failed to recover", child.fullName(), err)
+			return nil, false
+		}
+	}
 
-	ok := env.newChildEnv(n, child)
+	ok := env.newChildEnv(n, child, restart)
 	if !ok {
 		// Could not add child, probably a dupe
 		return nil, false
 	}
-	child.env = newActorEnv(child, receive)
+	child.env.activate()
 	return child, true
 }
 
 func (env *ActorEnv) findChild(name string) *Actor {
 	resC := make(chan *Actor)
-	safeSend(env.cbox, cFindMember{name, resC},
-		env.This, "actorEnv.findChild()")
+	if !env.post(env.cbox, cFindMember{name, resC}) {
+		return nil
+	}
 	child := <-resC
 	return child
 }
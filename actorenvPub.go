@@ -1,6 +1,8 @@
 package actor
 
 import (
+	"context"
+	"sync"
 	"time"
 )
 
@@ -15,15 +17,39 @@ type ActorEnv struct {
 	This        *Actor
 	behaviors   []interface{} // Two types
 	behavior    interface{}   // Two types
-	mbox        chan Msg
+	class       ActorClass    // If created from one, for its hooks
+	forRestart  bool          // Dying to be restarted
+	mbox        *tMailbox
 	cbox        chan interface{}
 	sbox        chan interface{}
 	farmRec     *tFarmData
 	ohook       chan Obit
 	msgObit     bool
 	dhook       chan bool
+	ctx         context.Context
+	cancel      context.CancelFunc // Called as dying begins
 	deathTimer  *time.Timer
+	exitReason  Reason  // Why mainLoop() ended
+	trapExits   bool    // Only touched by mainLoop()
+	timers      tTimers // SendAfter() and friends
 	lastMessage Msg
+	asker       *Future    // Set while handling an Ask()
+	envelope    Envelope   // Of the message being handled
+	current     Msg        // As queued, for Stash()
+	stashMu     sync.Mutex // Guards stash and stashShut
+	stash       []Msg
+	stashShut   bool // Once die() has taken stash
+	stashCap    int
+	idleLimit   time.Duration // Only touched by mainLoop()
+	supervisor  SupervisorStrategy
+	restarts    []time.Time
+	boxLock     sync.RWMutex // Guards boxesClosed
+	boxesClosed bool
+	restarting  map[*Actor]tEmptyStruct
+	backoff     *Backoff
+	backoffs    map[string]*tBackoffState
+	pending     map[string][]Msg // Mail for restarting children
+	persist     *tPersistState   // Only for persistent actors
 }
 
 /* These functions are usable by an agent to change it's
@@ -59,6 +85,14 @@ func (env *ActorEnv) AddDieHook(ch chan bool) {
 	env.dhook = ch
 }
 
+// Context returns a context which is canceled as soon as the
+// actor starts to die, however it dies.  A long-running Receive
+// can watch it to learn that it should stop, in place of
+// AddDieHook().
+func (env *ActorEnv) Context() context.Context {
+	return env.ctx
+}
+
 // Suicide() will cause an actor to gracefully die.
 // This process shuts down the actor as follows:
 // 1. The actor accepts no new incoming message
@@ -69,7 +103,22 @@ func (env *ActorEnv) AddDieHook(ch chan bool) {
 // 6. Death
 //
 func (env *ActorEnv) Suicide() {
-	safeSend(env.sbox, sHappyDeath{}, env, "ActorEnv.Suicide()")
+	if !env.post(env.sbox, sHappyDeath{}) {
+		dlog(env, "is already dead")
+	}
+}
+
+// SetReceiveTimeout has the system send the actor ReceiveTimeout{}
+// whenever it has been without messages for d, replacing any
+// ActorOptions.ReceiveTimeout.  The idle clock restarts after
+// every message.  A d of zero stops the notices.
+func (env *ActorEnv) SetReceiveTimeout(d time.Duration) {
+	env.post(env.sbox, sReceiveTimeout{d})
+}
+
+// CancelReceiveTimeout is the same as SetReceiveTimeout(0).
+func (env *ActorEnv) CancelReceiveTimeout() {
+	env.SetReceiveTimeout(0)
 }
 
 // Become allows an actor to change it's behavior.  A normal use of
@@ -93,16 +142,36 @@ func (env *ActorEnv) Revert() bool {
 	return true
 }
 
-// Return allows an actor to send a message to its parent.
-func (env *ActorEnv) Return(msg Msg) {
-	env.This.parent.Send(msg)
+// Return allows an actor to send a message to its parent.  The
+// error is as for Actor.Send().
+func (env *ActorEnv) Return(msg Msg) error {
+	return env.This.parent.Send(msg)
+}
+
+// Reply answers the message currently being handled.  If it was
+// sent with Actor.Ask() the Future is resolved; otherwise msg is
+// sent to the Sender(), carrying the same correlation ID.  It
+// returns false when there is nobody to answer, the asker has
+// already given up, or the sender would not take the reply.
+// Reply must be called from within Receive.
+func (env *ActorEnv) Reply(msg Msg) bool {
+	if env.asker != nil {
+		return env.asker.resolve(msg, nil)
+	}
+	if env.envelope.Sender == nil {
+		return false
+	}
+	return env.envelope.Sender.SendEnvelope(msg, Envelope{
+		Sender:        env.This,
+		CorrelationID: env.envelope.CorrelationID,
+	}) == nil
 }
 
 // GetChildrensNames() returns a slice with pointers
 // to the names of all children.
 func (env *ActorEnv) GetChildrensNames() []string {
-	r := make([]string, 1)
-	for _, k := range env.This.children {
+	r := make([]string, 0)
+	for _, k := range env.GetChildren() {
 		r = append(r, k.Id)
 	}
 	return r
@@ -111,11 +180,11 @@ func (env *ActorEnv) GetChildrensNames() []string {
 // GetChildren() returns a slice with pointers to all
 // children.
 func (env *ActorEnv) GetChildren() []*Actor {
-	alist := make([]*Actor, 0)
-	for _, a := range env.This.children {
-		alist = append(alist, a)
+	resC := make(chan []*Actor, 1)
+	if !env.post(env.cbox, cGetChildren{resC}) {
+		return make([]*Actor, 0)
 	}
-	return alist
+	return <-resC
 }
 
 // NewActorFarm takes a generator and a channel.  For each message
@@ -128,10 +197,24 @@ func (env *ActorEnv) NewActorFarm(farm FarmClass) *Actor {
 }
 
 func (env *ActorEnv) NewNamedActorFarm(n string, f FarmClass) *Actor {
-	farmerActor := env.NewNamedActor(n,
-		genFarmReceiveAdaptor(f.GetDistChan(), f.GenFarmer()))
-	go manageFarmer(farmerActor.env, f.GenWorker,
-		f.GetDistChan(), f.GetMaxWorkers())
+	return env.newActorFarm(n, &ActorOptions{Farm: f}, false)
+}
+
+func (env *ActorEnv) newActorFarm(n string, aO *ActorOptions,
+	restart bool) *Actor {
+
+	f := aO.Farm
+	link := newFarmLink(f)
+	farmerActor, ok := env.newChild(n,
+		genFarmReceiveAdaptor(link, f.GenFarmer()), aO, restart)
+	if !ok {
+		return nil
+	}
+	if m, ok := f.(FarmModer); ok && m.GetMode() == WorkerPool {
+		go manageWorkerPool(farmerActor.env, f, link)
+	} else {
+		go manageFarmer(farmerActor.env, f, link)
+	}
 	return farmerActor
 }
 
@@ -147,7 +230,20 @@ func (env *ActorEnv) NewActor(receive Receive) *Actor {
 func (env *ActorEnv) NewNamedActor(n string,
 	receive interface{}) *Actor {
 
-	newAct, ok := env.newChild(n, receive)
+	newAct, ok := env.newChild(n, receive, nil, false)
+	if ok == false {
+		return nil
+	}
+	return newAct
+}
+
+// NewNamedActorObject creates a child actor which handles its
+// messages with obj.Receive(), and whose lifecycle hooks (see
+// Starter, Stopper and Restarter) are called by the framework.
+func (env *ActorEnv) NewNamedActorObject(n string,
+	obj ActorClass) *Actor {
+
+	newAct, ok := env.newChild(n, obj, nil, false)
 	if ok == false {
 		return nil
 	}
@@ -165,14 +261,14 @@ func (env *ActorEnv) NewNamedOptionedActor(n string,
 	switch {
 	case aO.Receive != nil:
 		var ok bool
-		newActor, ok = env.newChild(n, aO.Receive)
+		newActor, ok = env.newChild(n, aO.Receive, aO, false)
 		if !ok {
 			elog(env, "Failed to create actor using "+
 				"specified Receive", n)
 			return nil
 		}
 	case aO.Farm != nil:
-		newActor = env.NewNamedActorFarm(n, aO.Farm)
+		newActor = env.newActorFarm(n, aO, false)
 		if newActor == nil {
 			elog(env, "Failed to create farm", n)
 			return nil
@@ -182,23 +278,7 @@ func (env *ActorEnv) NewNamedOptionedActor(n string,
 			"constructor (Receive or Farm)")
 		return nil
 	}
-	newActor.validator = aO.Validator
-
-	if aO.AgeOut != 0 {
-		timer := time.AfterFunc(aO.AgeOut, func() {
-			defer recover()
-			newActor.env.Suicide()
-		})
-		newActor.env.deathTimer = timer
-	}
 
-	if aO.FirstMessage != nil {
-		newActor.SendBlocking(aO.FirstMessage)
-	}
-
-	if aO.LastMessage != nil {
-		newActor.env.lastMessage = aO.LastMessage
-	}
 	return newActor
 }
 
@@ -2,72 +2,110 @@ package actor
 
 import (
 	"github.com/hishboy/gocommons/lang"
+	"io"
 	"reflect"
+	"time"
 )
 
-func manageFarmer(env *ActorEnv, generator interface{},
-	distChan chan Msg, limit int) {
-
-	g := generator
+func manageFarmer(env *ActorEnv, f FarmClass, link *tFarmLink) {
+	g := f.GenWorker
+	limit := f.GetMaxWorkers()
+	if as := getAutoscale(f); as != nil {
+		limit = as.MaxWorkers
+	}
 	actorsLeft := limit
-	dC := distChan
+	room := max(limit, 1) // Tasks which may wait for a worker
+	in := startFarmInput(f)
+	defer in.close()
 	deaths := make(chan Obit, 10)
 	killMe := make(chan bool, 1)
 	moreComing := true
 	moreToSend := true
+	paused := false
 	msgQ := lang.NewQueue()
+	book := newFarmBook(env, f)
+	defer close(book.quit)
+	stats := func() FarmStats {
+		return FarmStats{Queued: msgQ.Len(), Active: limit - actorsLeft,
+			Completed: book.done.Succeeded, Failed: book.done.Failed,
+			Paused: paused}
+	}
+	defer link.close(stats)
 	env.AddObitHook(deaths)
 	env.AddDieHook(killMe)
 CLEANUP:
 	for moreToSend {
+		if moreComing && !paused && msgQ.Len() < room {
+			in.request()
+		}
 		select {
 		case <-killMe:
 			moreToSend = false
 			dlog(env, "received a killMe")
 			break CLEANUP
-		case m := <-dC:
-			if m == nil {
+		case s := <-in.ch:
+			if in.received(s, book, msgQ) {
+				moreComing = false
+			}
+		case m := <-link.tasks:
+			if in.dispatched(m, moreComing, book, msgQ) {
 				moreComing = false
-				dlog(env, "Received nil, closing.")
-				dC = make(chan Msg, 0)
-				defer func() { close(dC) }()
+			}
+		case o := <-deaths:
+			actorsLeft++
+			if t, ok := book.tasks[o.A]; ok && t.finished &&
+				o.Reason.Kind == Normal {
+
+				book.succeeded(o.A)
 			} else {
-				switch m[0].(type) {
-				case EndSentinel:
-					moreComing = false
-				default:
-					msgQ.Push(m)
+				book.lost(o.A) // Exited, or killed, mid task
+			}
+		case cd := <-link.failures:
+			book.failed(cd)
+			if cd.A != nil {
+				cd.A.Die() // It would never Suicide() now
+			}
+		case t := <-book.retries:
+			if _, ok := book.delayed[t]; ok {
+				delete(book.delayed, t)
+				msgQ.Push(t)
+			}
+		case ch := <-link.stats:
+			ch <- stats()
+		case c := <-link.control:
+			switch c.(type) {
+			case PauseFarm:
+				paused = true
+			case ResumeFarm:
+				paused = false
+			case DrainFarm:
+				moreComing, paused = false, false
+				in.close()
+			case CancelFarm:
+				moreComing, paused = false, false
+				in.close()
+				for _, a := range book.cancel(msgQ) {
+					a.Kill()
 				}
 			}
-		case <-deaths:
-			actorsLeft++
 		}
 		// Task dispatch
-		if actorsLeft > 0 && msgQ.Len() > 0 {
+		if !paused && actorsLeft > 0 && msgQ.Len() > 0 {
 			dlog(env, "dispatching")
 			actorsLeft--
-			var a *Actor
-			embryo := g.(func() interface{})
-			fetus := embryo()
-			switch f := fetus.(type) {
-			case func(Msg, *ActorEnv):
-				a = env.NewActor(f)
-			case FarmClass:
-				a = env.NewActorFarm(f)
-			case *ActorOptions:
-				a = env.NewOptionedActor(f)
-			default:
-				dlog(env, "generator is of unsupported type",
-					reflect.TypeOf(a))
-			}
+			t := msgQ.Poll().(*tFarmTask)
+			a := spawnOneShot(env, g, t)
+			book.dispatched(a, t)
 			if a == nil {
-				elog(env, "Failed to create actor despite",
-					"recognized type of", reflect.TypeOf(fetus))
+				actorsLeft++
+			} else {
+				a.Monitor(env.This)
+				a.Send(t.msg)
 			}
-			a.Monitor(env.This)
-			a.Send(msgQ.Poll().(Msg))
 		}
-		if !moreComing && msgQ.Len() == 0 {
+		if !moreComing && !in.pending && msgQ.Len() == 0 &&
+			actorsLeft == limit && len(book.delayed) == 0 {
+
 			moreToSend = false
 		}
 	}
@@ -78,8 +116,573 @@ CLEANUP:
 		case <-killMe:
 			dlog(env, "Farmer just told to die off when",
 				"already in CLEANUP")
+		case ch := <-link.stats:
+			ch <- stats()
+		case m := <-link.tasks:
+			rejectTask(env, m)
 		}
 	}
-	env.This.Send(Msg{WorkComplete{}})
+	book.finish()
+	env.This.Send(Msg{book.done})
 	dlog(env, "Exiting")
 }
+
+// spawnWorker makes a worker child from what generator returns.
+// wrap, if not nil, is applied to the worker's Receive; a worker
+// which is itself a farm cannot be wrapped.
+func spawnWorker(env *ActorEnv, generator func() interface{},
+	wrap func(Receive) Receive) *Actor {
+
+	var a *Actor
+	fetus := generator()
+	switch f := fetus.(type) {
+	case func(Msg, *ActorEnv):
+		if wrap != nil {
+			f = wrap(f)
+		}
+		a = env.NewActor(f)
+	case Receive:
+		if wrap != nil {
+			f = wrap(f)
+		}
+		a = env.NewActor(f)
+	case FarmClass:
+		if wrap != nil {
+			elog(env, "a farm cannot be a pooled worker")
+			return nil
+		}
+		a = env.NewActorFarm(f)
+	case *ActorOptions:
+		if wrap != nil && f.Receive != nil {
+			aO := *f
+			aO.Receive = wrap(f.Receive)
+			f = &aO
+		}
+		a = env.NewOptionedActor(f)
+	default:
+		dlog(env, "generator is of unsupported type",
+			reflect.TypeOf(fetus))
+	}
+	if a == nil {
+		elog(env, "Failed to create actor despite",
+			"recognized type of", reflect.TypeOf(fetus))
+	}
+	return a
+}
+
+// spawnOneShot makes a OneShot worker for t, which marks t
+// finished once its Receive returns without panicking.  A worker
+// which is itself a farm cannot be wrapped, so its task is taken
+// to be finished if it dies normally.
+func spawnOneShot(env *ActorEnv, generator func() interface{},
+	t *tFarmTask) *Actor {
+
+	t.finished = false
+	fetus := generator()
+	if _, ok := fetus.(FarmClass); ok {
+		t.finished = true
+		return spawnWorker(env, func() interface{} { return fetus }, nil)
+	}
+	wrap := func(r Receive) Receive {
+		return func(msg Msg, wenv *ActorEnv) {
+			r(msg, wenv)
+			t.finished = true // Read once the worker has died
+		}
+	}
+	return spawnWorker(env, func() interface{} { return fetus }, wrap)
+}
+
+// tWorkerDone is sent by a pooled worker each time its Receive
+// returns, or panics.
+type tWorkerDone struct {
+	a  *Actor
+	ok bool // False if Receive panicked
+}
+
+// manageWorkerPool is manageFarmer() for the WorkerPool mode.
+func manageWorkerPool(env *ActorEnv, f FarmClass, link *tFarmLink) {
+	generator := f.GenWorker
+	as := getAutoscale(f)
+	least, most := f.GetMaxWorkers(), f.GetMaxWorkers()
+	var tick <-chan time.Time
+	if as != nil {
+		least, most = as.MinWorkers, as.MaxWorkers
+		ticker := time.NewTicker(as.checkEvery())
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	room := max(most, 1) // Tasks which may wait for a worker
+	in := startFarmInput(f)
+	defer in.close()
+	deaths := make(chan Obit, 10)
+	killMe := make(chan bool, 1)
+	done := make(chan tWorkerDone, most)
+	msgQ := lang.NewQueue()
+	book := newFarmBook(env, f)
+	defer close(book.quit)
+	wrap := func(r Receive) Receive {
+		return func(msg Msg, wenv *ActorEnv) {
+			ok := false
+			defer func() {
+				select {
+				case done <- tWorkerDone{wenv.This, ok}:
+				case <-book.quit:
+				}
+			}()
+			r(msg, wenv)
+			ok = true
+		}
+	}
+	busy := make(map[*Actor]bool) // Every worker, and if it is busy
+	idle := make([]*Actor, 0, most)
+	idleSince := make(map[*Actor]time.Time)
+	paused := false
+	stats := func() FarmStats {
+		return FarmStats{Queued: msgQ.Len(),
+			Active: len(busy) - len(idle), Idle: len(idle),
+			Completed: book.done.Succeeded, Failed: book.done.Failed,
+			Paused: paused}
+	}
+	defer link.close(stats)
+	env.AddObitHook(deaths)
+	env.AddDieHook(killMe)
+	rest := func(a *Actor) {
+		busy[a] = false
+		idle = append(idle, a)
+		idleSince[a] = time.Now()
+	}
+	hire := func() bool {
+		a := spawnWorker(env, generator, wrap)
+		if a == nil {
+			return false
+		}
+		a.Monitor(env.This)
+		rest(a)
+		return true
+	}
+	// forget drops a from the pool, returning false if it was not
+	// in it.
+	forget := func(a *Actor) bool {
+		if _, ok := busy[a]; !ok {
+			return false
+		}
+		delete(busy, a)
+		delete(idleSince, a)
+		for i, ia := range idle {
+			if ia == a {
+				idle = append(idle[:i], idle[i+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	// pressed reports whether the backlog calls for another
+	// worker.  The thresholds apply only beyond the first.
+	pressed := func(now time.Time) bool {
+		if as == nil || len(busy) >= most {
+			return false
+		}
+		if len(busy) == 0 && msgQ.Len() > 0 {
+			return true
+		}
+		if as.ScaleUpQueue <= 0 && as.ScaleUpLatency <= 0 {
+			return true
+		}
+		if as.ScaleUpQueue > 0 && msgQ.Len() > as.ScaleUpQueue {
+			return true
+		}
+		return as.ScaleUpLatency > 0 &&
+			now.Sub(msgQ.Peek().(*tFarmTask).queued) >= as.ScaleUpLatency
+	}
+	for i := 0; i < least; i++ {
+		hire()
+	}
+	moreComing := true
+	for moreComing || in.pending || msgQ.Len() > 0 ||
+		book.outstanding() > 0 {
+
+		if moreComing && !paused && msgQ.Len() < room {
+			in.request()
+		}
+		select {
+		case <-killMe:
+			dlog(env, "received a killMe")
+			return
+		case s := <-in.ch:
+			if in.received(s, book, msgQ) {
+				moreComing = false
+			}
+		case m := <-link.tasks:
+			if in.dispatched(m, moreComing, book, msgQ) {
+				moreComing = false
+			}
+		case d := <-done:
+			if !busy[d.a] {
+				break // Not one of its tasks, or already replaced
+			}
+			if d.ok {
+				book.succeeded(d.a)
+				rest(d.a)
+			} else {
+				// Its task is accounted for by the ChildDied
+				dlog(env, "replacing a worker which panicked")
+				forget(d.a)
+				d.a.Die()
+				hire()
+			}
+		case o := <-deaths:
+			if busy[o.A] {
+				book.lost(o.A)
+			}
+			if forget(o.A) && len(busy) < least {
+				dlog(env, "replacing a worker which died")
+				hire()
+			}
+		case cd := <-link.failures:
+			book.failed(cd)
+		case t := <-book.retries:
+			if _, ok := book.delayed[t]; ok {
+				delete(book.delayed, t)
+				msgQ.Push(t)
+			}
+		case ch := <-link.stats:
+			ch <- stats()
+		case c := <-link.control:
+			switch c.(type) {
+			case PauseFarm:
+				paused = true
+			case ResumeFarm:
+				paused = false
+			case DrainFarm:
+				moreComing, paused = false, false
+				in.close()
+			case CancelFarm:
+				moreComing, paused = false, false
+				in.close()
+				book.cancel(msgQ) // The workers are killed below
+			}
+		case now := <-tick:
+			// Scale down, oldest idle first
+			for len(idle) > 0 && len(busy) > least &&
+				as.ScaleDownIdle > 0 &&
+				now.Sub(idleSince[idle[0]]) >= as.ScaleDownIdle {
+
+				dlog(env, "retiring an idle worker")
+				a := idle[0]
+				forget(a)
+				a.Die()
+			}
+		}
+		if !paused && len(busy) == 0 && msgQ.Len() > 0 && !hire() {
+			// As OneShot gives up on a task it has no worker for
+			elog(env, "no worker can be hired, giving up")
+			for msgQ.Len() > 0 {
+				book.giveUp(msgQ.Poll().(*tFarmTask))
+			}
+			moreComing = false
+			in.close()
+		}
+		// Task dispatch, and scaling up
+		now := time.Now()
+		for !paused && msgQ.Len() > 0 {
+			if len(idle) == 0 && !(pressed(now) && hire()) {
+				break
+			}
+			a := idle[len(idle)-1] // The most recently used
+			idle = idle[:len(idle)-1]
+			busy[a] = true
+			t := msgQ.Poll().(*tFarmTask)
+			book.dispatched(a, t)
+			a.Send(t.msg)
+		}
+	}
+	for a := range busy {
+		if book.done.Cancelled {
+			a.Kill()
+		} else {
+			a.Die()
+		}
+	}
+	for len(busy) > 0 {
+		select {
+		case o := <-deaths:
+			delete(busy, o.A)
+		case ch := <-link.stats:
+			ch <- stats()
+		case m := <-link.tasks:
+			rejectTask(env, m)
+		case <-killMe:
+			dlog(env, "Farmer just told to die off when",
+				"already in CLEANUP")
+			return
+		}
+	}
+	book.finish()
+	env.This.Send(Msg{book.done})
+	dlog(env, "Exiting")
+}
+
+// tFarmTask is a message to be handled by a worker, and how often
+// it has been tried.
+type tFarmTask struct {
+	msg      Msg
+	id       string // For the checkpoint, if there is one
+	attempts int
+	finished bool      // By a OneShot worker which has not panicked
+	queued   time.Time // When it last joined the queue
+}
+
+// tFarmBook keeps the accounts of a farm's tasks, and schedules
+// their retries.  It is used only by the farm's manager.
+type tFarmBook struct {
+	retry   *FarmRetry
+	tasks   map[*Actor]*tFarmTask       // Being worked on, by worker
+	retries chan *tFarmTask             // Retries which are due
+	delayed map[*tFarmTask]tEmptyStruct // Retries not yet due
+	quit    chan tEmptyStruct           // Closed when the manager exits
+	done    WorkComplete
+	env     *ActorEnv
+	ckpt    *FarmCheckpoint
+	farm    string          // Its name in the checkpoint
+	skip    map[string]bool // Tasks completed in an earlier run
+	begun   map[string]bool // Tasks dispatched in an earlier run
+}
+
+func newFarmBook(env *ActorEnv, f FarmClass) *tFarmBook {
+	b := &tFarmBook{
+		tasks:   make(map[*Actor]*tFarmTask),
+		delayed: make(map[*tFarmTask]tEmptyStruct),
+		retries: make(chan *tFarmTask),
+		quit:    make(chan tEmptyStruct),
+		env:     env,
+	}
+	if r, ok := f.(FarmRetrier); ok {
+		b.retry = r.GetRetry()
+	}
+	if c, ok := f.(FarmCheckpointer); ok && c.GetCheckpoint() != nil {
+		b.ckpt = c.GetCheckpoint()
+		b.farm = env.This.fullName()
+		if b.ckpt.Store == nil || b.ckpt.TaskID == nil {
+			elog(env, "checkpoint needs a Store and TaskID, ignored")
+			b.ckpt = nil
+			return b
+		}
+		cp, err := b.ckpt.Store.Load(b.farm)
+		if err != nil {
+			elog(env, "failed to load checkpoint, redoing all tasks:",
+				err)
+		} else {
+			b.skip, b.begun = cp.Completed, cp.Dispatched
+		}
+	}
+	return b
+}
+
+// admit returns the task for msg from the farm's source, or nil
+// if the checkpoint says it is done already.
+func (b *tFarmBook) admit(msg Msg) *tFarmTask {
+	t := &tFarmTask{msg: msg, queued: time.Now()}
+	if b.ckpt != nil {
+		t.id = b.ckpt.TaskID(msg)
+		if b.skip[t.id] {
+			b.done.Skipped++
+			return nil
+		}
+		if b.begun[t.id] {
+			b.done.Redone++
+		}
+	}
+	return t
+}
+
+// record passes a task to the checkpoint store with put.
+func (b *tFarmBook) record(put func(farm, id string) error,
+	t *tFarmTask) {
+
+	if b.ckpt == nil {
+		return
+	}
+	if err := put(b.farm, t.id); err != nil {
+		elog(b.env, "failed to checkpoint task", t.id, err)
+	}
+}
+
+// finish clears the checkpoint of a farm which has nothing left
+// to do, and releases any other.
+func (b *tFarmBook) finish() {
+	if b.ckpt == nil {
+		return
+	}
+	if b.done.Failed > 0 || b.done.Cancelled || b.done.SourceErr != nil {
+		if err := b.ckpt.Store.Release(b.farm); err != nil {
+			elog(b.env, "failed to release checkpoint", err)
+		}
+		return
+	}
+	if err := b.ckpt.Store.Clear(b.farm); err != nil {
+		elog(b.env, "failed to clear checkpoint", err)
+	}
+}
+
+func (b *tFarmBook) dispatched(a *Actor, t *tFarmTask) {
+	if a == nil {
+		b.giveUp(t)
+		return
+	}
+	t.attempts++
+	if t.attempts == 1 && b.ckpt != nil {
+		b.record(b.ckpt.Store.Dispatched, t)
+	}
+	b.tasks[a] = t
+	b.done.Dispatched++
+}
+
+// outstanding counts the tasks being worked on or to be retried.
+func (b *tFarmBook) outstanding() int {
+	return len(b.tasks) + len(b.delayed)
+}
+
+func (b *tFarmBook) succeeded(a *Actor) {
+	if t, ok := b.tasks[a]; ok {
+		delete(b.tasks, a)
+		b.done.Succeeded++
+		if b.ckpt != nil {
+			b.record(b.ckpt.Store.Completed, t)
+		}
+	}
+}
+
+// lost accounts for the task of a worker which died without
+// finishing it.
+func (b *tFarmBook) lost(a *Actor) {
+	if t, ok := b.tasks[a]; ok {
+		delete(b.tasks, a)
+		b.giveUp(t)
+	}
+}
+
+// failed retries the task of a worker which panicked, if the
+// retry policy allows, or gives up on it.
+func (b *tFarmBook) failed(cd ChildDied) {
+	t, ok := b.tasks[cd.A]
+	if !ok {
+		return // Not working on a task of ours
+	}
+	delete(b.tasks, cd.A)
+	r := b.retry
+	if r == nil || t.attempts >= r.MaxAttempts ||
+		r.Retryable != nil && !r.Retryable(cd.Err) {
+
+		b.giveUp(t)
+		return
+	}
+	b.done.Retried++
+	b.delayed[t] = tEmptyStruct{}
+	var delay time.Duration
+	if r.Backoff != nil {
+		delay = r.Backoff.delay(t.attempts - 1)
+	}
+	time.AfterFunc(delay, func() {
+		t.queued = time.Now()
+		select {
+		case b.retries <- t:
+		case <-b.quit:
+		}
+	})
+}
+
+// cancel drops every task queued, delayed or being worked on,
+// returning the workers of the last.
+func (b *tFarmBook) cancel(msgQ *lang.Queue) []*Actor {
+	b.done.Cancelled = true
+	for msgQ.Len() > 0 {
+		b.drop(msgQ.Poll().(*tFarmTask))
+	}
+	for t := range b.delayed {
+		b.drop(t)
+	}
+	clear(b.delayed)
+	workers := make([]*Actor, 0, len(b.tasks))
+	for a, t := range b.tasks {
+		b.drop(t)
+		workers = append(workers, a)
+	}
+	clear(b.tasks)
+	return workers
+}
+
+func (b *tFarmBook) drop(t *tFarmTask) {
+	b.done.Dropped = append(b.done.Dropped, t.msg)
+}
+
+// sourceEnded records why the farm's source ended.
+func (b *tFarmBook) sourceEnded(err error) {
+	if err != io.EOF {
+		b.done.SourceErr = err
+	}
+}
+
+func (b *tFarmBook) giveUp(t *tFarmTask) {
+	b.done.Failed++
+	b.done.FailedMsgs = append(b.done.FailedMsgs, t.msg)
+}
+
+// tFarmLink connects a farmer's Receive to its manager.
+type tFarmLink struct {
+	tasks    chan Msg       // Dispatched
+	failures chan ChildDied // Of workers
+	stats    chan chan FarmStats
+	control  chan interface{}  // PauseFarm and the like
+	done     chan tEmptyStruct // Closed when the manager exits
+	final    FarmStats         // Valid once done is closed
+}
+
+func newFarmLink(f FarmClass) *tFarmLink {
+	workers := f.GetMaxWorkers()
+	if as := getAutoscale(f); as != nil {
+		workers = as.MaxWorkers
+	}
+	return &tFarmLink{
+		tasks:    make(chan Msg),
+		failures: make(chan ChildDied, workers),
+		stats:    make(chan chan FarmStats),
+		control:  make(chan interface{}),
+		done:     make(chan tEmptyStruct),
+	}
+}
+
+func (l *tFarmLink) close(stats func() FarmStats) {
+	l.final = stats()
+	close(l.done)
+}
+
+// getStats asks the manager for the farm's stats.
+func (l *tFarmLink) getStats() FarmStats {
+	ch := make(chan FarmStats, 1)
+	select {
+	case l.stats <- ch:
+		return <-ch
+	case <-l.done:
+		return l.final
+	}
+}
+
+func getAutoscale(f FarmClass) *FarmAutoscale {
+	if a, ok := f.(FarmAutoscaler); ok {
+		return a.GetAutoscale()
+	}
+	return nil
+}
+
+// checkEvery is how often an autoscaling pool checks for workers
+// idle long enough to retire.
+func (as *FarmAutoscale) checkEvery() time.Duration {
+	d := as.ScaleDownIdle / 4
+	if d <= 0 {
+		d = 100 * time.Millisecond
+	}
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return d
+}
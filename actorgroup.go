@@ -1,9 +1,13 @@
 package actor
 
 import (
+	"context"
+	"fmt"
 	"github.com/aprimus/actor/stringgenerator"
 	"github.com/aprimus/immutable/imHash"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,18 +22,30 @@ type ActorGroup struct {
 	stringControl  chan bool //Shuts down string generator
 	db             *imHash.StringHash
 	dbReq          chan interface{}
+	deadLetters    *Actor
+	grainMu        sync.Mutex // Guards grainKinds and grains
+	grainKinds     map[string]GrainKind
+	grains         map[tGrainKey]*tGrain
+	// KillAfter is how long GracefulActiveShutdown() lets actors
+	// take to die, before killing them.  Zero waits forever.
+	KillAfter time.Duration
 }
 
+// DefaultKillAfter is the KillAfter of a new ActorGroup.
+var DefaultKillAfter = 30 * time.Second
+
 func NewActorGroup(name string) *ActorGroup {
 	ag := &ActorGroup{
-		Id: name,
+		Id:        name,
+		KillAfter: DefaultKillAfter,
 	}
 	ag.memberCh = make(chan interface{}, 20)
+	ag.ewg.Add(1)
 	go func() {
 		defer ag.ewg.Done()
-		ag.ewg.Add(1)
 		ag.manageMembers(ag.memberCh)
 	}()
+	ag.deadLetters = newDeadLetterOffice(ag)
 	ag.guardian = newGuardian(ag)
 	ag.uniqueStringCh, ag.stringControl =
 		stringgenerator.NewGenerator(name, ag.ewg)
@@ -40,21 +56,39 @@ func NewActorGroup(name string) *ActorGroup {
 func (ag *ActorGroup) GetOrCreateActor(n string,
 	f ReceiveGenerator) *Actor {
 
-	a, ok := ag.GetNamedActor(n)
-	if ok == false {
-		a = ag.NewNamedActor(n, f())
+	for {
+		if a, ok := ag.GetNamedActor(n); ok {
+			return a
+		}
+		if a := ag.NewNamedActor(n, f()); a != nil {
+			return a
+		}
+		// Lost a race to create it, unless the group is dying
+		if ag.guardian.env.Context().Err() != nil {
+			return nil
+		}
 	}
-	return a
 }
 
 func (ag *ActorGroup) GetOrCreateActorObject(n string,
 	suf SetupFunc, ch chan interface{}) *Actor {
 
-	a, ok := ag.GetNamedActor(n)
-	if ok == false {
-		a = ag.NewNamedActor(n, receiverFromClass(suf, ch))
+	var class ActorClass // Set up once, as it may read from ch
+	for {
+		if a, ok := ag.GetNamedActor(n); ok {
+			return a
+		}
+		if class == nil {
+			class = classFromSetup(suf, ch)
+		}
+		if a := ag.NewNamedActorObject(n, class); a != nil {
+			return a
+		}
+		// Lost a race to create it, unless the group is dying
+		if ag.guardian.env.Context().Err() != nil {
+			return nil
+		}
 	}
-	return a
 }
 
 // NewOptionedActor allows creation of an actor with
@@ -78,8 +112,8 @@ func (ag *ActorGroup) NewNamedOptionedActor(n string,
 // GetNamedActor() queries the ActorGroup to see if an appropriately
 // named actor exists, returning the actor if possible.
 func (ag *ActorGroup) GetNamedActor(n string) (*Actor, bool) {
-	a, ok := ag.guardian.children[n]
-	if ok {
+	a := ag.guardian.env.findChild(n)
+	if a != nil {
 		return a, true
 	} else {
 		return nil, false
@@ -101,7 +135,8 @@ func (ag *ActorGroup) SendByFullName(name string, msg Msg) bool {
 	ch := make(chan *Actor)
 	ag.memberCh <- cFindMember{name, ch}
 	resp := <-ch
-	if ch == nil {
+	if resp == nil {
+		ag.deadLetter(DeadLetter{msg, nil, name, ErrNoSuchActor})
 		return false
 	} else {
 		resp.Send(msg)
@@ -117,13 +152,22 @@ func (ag *ActorGroup) SendByFullName(name string, msg Msg) bool {
 func (ag *ActorGroup) SendOrCreateByName(name string,
 	msg Msg, r Receive) {
 
-	exists := ag.SendByName(name, msg)
-	if exists {
-		return
+	for {
+		exists := ag.guardian.sendByName(name, msg)
+		if exists {
+			return
+		}
+		if a := ag.NewNamedActor(name, r); a != nil {
+			a.Send(msg)
+			return
+		}
+		// Lost a race to create it, unless the group is dying
+		if ag.guardian.env.Context().Err() != nil {
+			ag.deadLetter(DeadLetter{msg, nil,
+				ag.fullName() + ":" + name, ErrActorDead})
+			return
+		}
 	}
-	a := ag.NewNamedActor(name, r)
-	a.Send(msg)
-	return
 }
 
 // NewActor() returns an actor.  It is the same as NewNamedActor,
@@ -137,13 +181,22 @@ func (ag *ActorGroup) NewActor(r Receive) *Actor {
 func (ag *ActorGroup) NewNamedActor(n string, r Receive) *Actor {
 	// TODO: Put in a delay on channel to not return until
 	// actor is fully spun up
-	a, ok := ag.guardian.env.newChild(n, r)
+	a, ok := ag.guardian.env.newChild(n, r, nil, false)
 	if ok == false {
 		return nil
 	}
 	return a
 }
 
+// NewNamedActorObject is a pass-thru function to
+// actor.NewNamedActorObject, creating a top-level actor from
+// obj.
+func (ag *ActorGroup) NewNamedActorObject(n string,
+	obj ActorClass) *Actor {
+
+	return ag.guardian.env.NewNamedActorObject(n, obj)
+}
+
 // NewActorFarm is a pass-thru function to actor.NewActorFarm,
 // allowing a farm to be built at the top level in a group
 func (ag *ActorGroup) NewActorFarm(farm FarmClass) *Actor {
@@ -177,13 +230,22 @@ func (ag *ActorGroup) SendAll(msg Msg) {
 }
 
 func newGuardian(ag *ActorGroup) *Actor {
-	a := &Actor{Id: "GUARDIAN", Group: ag, validator: nil}
-	a.env = newActorEnv(a, func(msg Msg, env *ActorEnv) {
+	return newRootActor(ag, _GUARDIAN, func(msg Msg, env *ActorEnv) {
 		/* */
 	})
-	// guardian is NOT part of the sync group
-	ag.swg.Done()
+}
+
+// newRootActor creates an actor with no parent, for the group's
+// own use.
+func newRootActor(ag *ActorGroup, id string, r Receive) *Actor {
+	a := &Actor{Id: id, Group: ag, validator: nil}
 	a.children = make(map[string]*Actor)
+	a.watchers = make(map[tWatcher]tEmptyStruct)
+	a.links = make(map[*Actor]tEmptyStruct)
+	a.env = newActorEnv(a, r, nil)
+	a.env.activate()
+	// root actors are NOT part of the sync group
+	ag.swg.Done()
 	return a
 }
 
@@ -199,6 +261,7 @@ func (ag *ActorGroup) GracefulPassiveShutdown() {
 	}
 	ag.swg.Wait()
 	dlog(ag, "Returned from ag.swg.Wait()")
+	ag.stopDeadLetterOffice()
 	ag.stringControl <- true
 	<-ag.uniqueStringCh // Need to trigger reading control
 	ag.memberCh <- sHappyDeath{}
@@ -209,10 +272,71 @@ func (ag *ActorGroup) GracefulPassiveShutdown() {
 }
 
 // GracefulActiveShutdown notifies all actors to die,
-// and only returns after they have expired.
+// and only returns after they have expired.  Any still alive
+// after ag.KillAfter are killed.
 func (ag *ActorGroup) GracefulActiveShutdown() {
+	ctx := context.Background()
+	if ag.KillAfter > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ag.KillAfter)
+		defer cancel()
+	}
+	if err := ag.Shutdown(ctx); err != nil {
+		elog(ag, err)
+	}
+}
+
+// ShutdownError is returned by Shutdown() when actors outlived
+// its context.  Survivors holds their full names.
+type ShutdownError struct {
+	Survivors []string
+	Err       error // The context's
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("actor: %d actors killed at shutdown (%v): %s",
+		len(e.Survivors), e.Err, strings.Join(e.Survivors, ", "))
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown notifies all actors to die, as GracefulActiveShutdown()
+// does, returning once they have.  If ctx ends first, the actors
+// still alive are killed, and a *ShutdownError naming them is
+// returned.
+func (ag *ActorGroup) Shutdown(ctx context.Context) error {
 	ag.guardian.Die()
+	done := make(chan tEmptyStruct)
+	go func() {
+		ag.swg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		survivors := make([]string, 0)
+		for _, rec := range ag.getMembers() {
+			survivors = append(survivors, rec.fname)
+		}
+		sort.Strings(survivors)
+		err = &ShutdownError{survivors, ctx.Err()}
+		ag.guardian.Kill()
+	}
 	ag.GracefulPassiveShutdown()
+	return err
+}
+
+// Kill kills the top-level actor with the given name, as
+// Actor.Kill() does, returning false if there is no such actor.
+func (ag *ActorGroup) Kill(name string) bool {
+	a, ok := ag.GetNamedActor(name)
+	if ok {
+		a.Kill()
+	}
+	return ok
 }
 
 // GetAllChildren returns a list of all the names of all
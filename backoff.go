@@ -0,0 +1,93 @@
+package actor
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// PendingPolicy determines what happens to messages sent by name
+// to a child while its supervisor is restarting it.
+type PendingPolicy int
+
+const (
+	// BufferPending holds the messages, delivering them in order
+	// to the restarted child.
+	BufferPending PendingPolicy = iota
+	// DropPending sends the messages to the dead letter office.
+	DropPending
+)
+
+// Backoff spaces out a supervisor's restarts of a crashing child,
+// so that whatever caused the crash is not hammered by it.  Set
+// it with ActorOptions.Backoff, alongside ActorOptions.Supervisor.
+//
+// The first restart of a child waits MinDelay, and each further
+// restart waits twice as long as the last, up to MaxDelay.  Each
+// delay is lengthened by a random fraction of itself, of at most
+// Jitter (so 0.2 adds up to 20%).  Once a restarted child has
+// stayed up for ResetAfter, its next restart is treated as its
+// first again.  A zero ResetAfter never resets.
+//
+// Messages sent to the child by name, with SendByName(), between
+// its failure and its recreation are handled according to
+// Pending.  Its name is kept for it meanwhile, so that no other
+// child can be created with it.
+type Backoff struct {
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+	Jitter     float64
+	ResetAfter time.Duration
+	Pending    PendingPolicy
+}
+
+// delay computes how long to wait before restart number attempt
+// (counting from zero).
+func (b *Backoff) delay(attempt int) time.Duration {
+	limit := b.MaxDelay
+	if limit == 0 {
+		limit = math.MaxInt64 / 4
+	}
+	d := b.MinDelay
+	for i := 0; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	if b.Jitter > 0 {
+		d += time.Duration(rand.Float64() * b.Jitter * float64(d))
+	}
+	return d
+}
+
+// nextBackoff returns the delay before restarting the named
+// child, and counts the restart against it.
+// This runs singly from mainLoop(), no race conditions
+func (env *ActorEnv) nextBackoff(name string) time.Duration {
+	if env.backoff == nil {
+		return 0
+	}
+	if env.backoffs == nil {
+		env.backoffs = make(map[string]*tBackoffState)
+	}
+	st, ok := env.backoffs[name]
+	if !ok {
+		st = &tBackoffState{}
+		env.backoffs[name] = st
+	}
+	if env.backoff.ResetAfter > 0 && !st.started.IsZero() &&
+		time.Since(st.started) >= env.backoff.ResetAfter {
+
+		st.attempts = 0
+	}
+	d := env.backoff.delay(st.attempts)
+	st.attempts++
+	return d
+}
+
+// holdPending reports whether messages for a restarting child
+// are to be kept for it.
+func (env *ActorEnv) holdPending() bool {
+	return env.backoff == nil || env.backoff.Pending == BufferPending
+}
@@ -0,0 +1,233 @@
+package actor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// FarmCheckpoint makes a farm resumable.  Each task is given an
+// ID by TaskID, and Store records which were dispatched and which
+// completed, under the farmer's full name.  A farm created again
+// under the same name, and fed the same tasks, skips those which
+// completed (counting them in WorkComplete.Skipped), so that only
+// unfinished work is dispatched again.  Tasks which failed or were
+// dropped are unfinished; those dispatched before, which may have
+// been part done, are counted in WorkComplete.Redone.  The
+// checkpoint is cleared once a farm completes with nothing
+// unfinished, and no SourceErr, and is otherwise released.
+type FarmCheckpoint struct {
+	Store  CheckpointStore
+	TaskID func(Msg) string
+}
+
+// FarmCheckpointer is implemented by a FarmClass which keeps a
+// checkpoint.
+type FarmCheckpointer interface {
+	GetCheckpoint() *FarmCheckpoint
+}
+
+// Checkpoint is what a CheckpointStore has recorded of a farm,
+// by task ID.
+type Checkpoint struct {
+	Dispatched map[string]bool
+	Completed  map[string]bool
+}
+
+// CheckpointStore keeps farm checkpoints.  A farm's manager calls
+// it from a single goroutine, but different farms may call it at
+// once.  Release is called as a farm completes without clearing its
+// checkpoint, when anything held for it may be let go until it
+// runs again.
+type CheckpointStore interface {
+	Load(farm string) (*Checkpoint, error)
+	Dispatched(farm, id string) error
+	Completed(farm, id string) error
+	Clear(farm string) error
+	Release(farm string) error
+}
+
+// ErrCheckpointCorrupt is returned when a FileCheckpointStore
+// cannot make sense of what it has stored.
+var ErrCheckpointCorrupt = errors.New("actor: checkpoint corrupt")
+
+// FileCheckpointStore is a CheckpointStore kept in a directory,
+// with a file for each farm to which records are appended.  A
+// record is written before the task it describes goes on, so
+// nothing recorded is lost if the process dies; with Sync set it
+// is also flushed to disk, so that nothing is lost if the machine
+// does.  A record left half written at the end of a file is
+// ignored.
+type FileCheckpointStore struct {
+	Dir   string
+	Sync  bool
+	mu    sync.Mutex
+	files map[string]*os.File // Open for appending, by farm
+}
+
+// NewFileCheckpointStore returns a FileCheckpointStore in dir,
+// creating it if need be.
+func NewFileCheckpointStore(dir string) (*FileCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileCheckpointStore{Dir: dir}, nil
+}
+
+func (s *FileCheckpointStore) fileName(farm string) string {
+	return filepath.Join(s.Dir, url.PathEscape(farm)+".ckpt")
+}
+
+// Load implements CheckpointStore.
+func (s *FileCheckpointStore) Load(farm string) (*Checkpoint, error) {
+	cp := &Checkpoint{make(map[string]bool), make(map[string]bool)}
+	f, err := os.Open(s.fileName(farm))
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return cp, nil // Clean end, or a torn record
+		}
+		if len(line) < 3 {
+			return nil, fmt.Errorf("%w: %s", ErrCheckpointCorrupt, farm)
+		}
+		id, err := strconv.Unquote(line[2 : len(line)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v",
+				ErrCheckpointCorrupt, farm, err)
+		}
+		switch line[0] {
+		case 'D':
+			cp.Dispatched[id] = true
+		case 'C':
+			cp.Completed[id] = true
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrCheckpointCorrupt, farm)
+		}
+	}
+}
+
+// Dispatched implements CheckpointStore.
+func (s *FileCheckpointStore) Dispatched(farm, id string) error {
+	return s.record(farm, 'D', id)
+}
+
+// Completed implements CheckpointStore.
+func (s *FileCheckpointStore) Completed(farm, id string) error {
+	return s.record(farm, 'C', id)
+}
+
+func (s *FileCheckpointStore) record(farm string, kind byte,
+	id string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.fileFor(farm)
+	if err != nil {
+		return err
+	}
+	rec := string(kind) + " " + strconv.Quote(id) + "\n"
+	if _, err = f.WriteString(rec); err != nil {
+		return err
+	}
+	if s.Sync {
+		return f.Sync()
+	}
+	return nil
+}
+
+// fileFor returns the file of farm, open for appending.  It must
+// be called with mu held.
+func (s *FileCheckpointStore) fileFor(farm string) (*os.File, error) {
+	if f, ok := s.files[farm]; ok {
+		return f, nil
+	}
+	if s.files == nil {
+		s.files = make(map[string]*os.File)
+	}
+	name := s.fileName(farm)
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// Drop any torn record, so the next begins on a line of its own
+	size, err := wholeLines(f)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.files[farm] = f
+	return f, nil
+}
+
+// wholeLines returns the length of f up to the end of its last
+// whole line.
+func wholeLines(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	var size int64
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return size, nil
+		}
+		size += int64(len(line))
+	}
+}
+
+// Clear implements CheckpointStore.
+func (s *FileCheckpointStore) Clear(farm string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[farm]; ok {
+		f.Close()
+		delete(s.files, farm)
+	}
+	err := os.Remove(s.fileName(farm))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Release implements CheckpointStore, closing the file of farm.
+func (s *FileCheckpointStore) Release(farm string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[farm]
+	if !ok {
+		return nil
+	}
+	delete(s.files, farm)
+	return f.Close()
+}
+
+// Close closes the files open for appending.  The store may still
+// be used afterwards; they are reopened as needed.
+func (s *FileCheckpointStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for farm, f := range s.files {
+		errs = append(errs, f.Close())
+		delete(s.files, farm)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package actor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoSuchActor is the Reason given for a dead letter which was
+// sent by name to an actor which does not exist.
+var ErrNoSuchActor = errors.New("actor: no actor by that name")
+
+// DeadLetter is the message delivered to subscribers of an
+// ActorGroup's dead letter office, once for each message which
+// could not be delivered.  Target is the actor the message was
+// meant for, or nil if it was sent by name to nobody; Name is
+// the full name it was sent to.  Reason is the error that
+// stopped it: ErrActorDead, ErrMsgRejected, ErrMailboxFull or
+// ErrNoSuchActor.
+type DeadLetter struct {
+	Msg    Msg
+	Target *Actor
+	Name   string
+	Reason error
+}
+
+func (d DeadLetter) GoString() string {
+	return fmt.Sprintf("DeadLetter{%s: %v}", d.Name, d.Reason)
+}
+
+type cDeadLetterSub struct {
+	a   *Actor
+	sub bool
+}
+
+// SubscribeDeadLetters has every DeadLetter in the group sent on
+// to a, for alerting or replay.  Messages which cannot be
+// delivered to a subscriber are not themselves dead lettered.
+func (ag *ActorGroup) SubscribeDeadLetters(a *Actor) {
+	ag.deadLetters.Send(Msg{cDeadLetterSub{a, true}})
+}
+
+// UnsubscribeDeadLetters undoes SubscribeDeadLetters.
+func (ag *ActorGroup) UnsubscribeDeadLetters(a *Actor) {
+	ag.deadLetters.Send(Msg{cDeadLetterSub{a, false}})
+}
+
+// deadLetter hands an undeliverable message to the office.  It
+// never fails, and never produces further dead letters.
+func (ag *ActorGroup) deadLetter(dl DeadLetter) {
+	if dl.Target != nil && dl.Name == "" {
+		dl.Name = dl.Target.fullName()
+	}
+	dlog(ag, "dead letter for ", dl.Name, ": ", dl.Reason)
+	if ag.deadLetters != nil {
+		ag.deadLetters.env.mbox.put(Msg{dl}, true)
+	}
+}
+
+func newDeadLetterOffice(ag *ActorGroup) *Actor {
+	subscribers := make(map[*Actor]tEmptyStruct)
+	return newRootActor(ag, _DEADLETTERS,
+		func(msg Msg, env *ActorEnv) {
+			switch m := msg[0].(type) {
+			case cDeadLetterSub:
+				if m.sub {
+					subscribers[m.a] = tEmptyStruct{}
+				} else {
+					delete(subscribers, m.a)
+				}
+			case DeadLetter:
+				for a := range subscribers {
+					err := a.env.mbox.put(msg, false)
+					if err == ErrActorDead {
+						delete(subscribers, a)
+					}
+				}
+			}
+		})
+}
+
+// stopDeadLetterOffice is the last step in shutting down the
+// group's actors.
+func (ag *ActorGroup) stopDeadLetterOffice() {
+	notice := make(tDeathNotice)
+	ag.deadLetters.watch(notice)
+	ag.deadLetters.Die()
+	<-notice
+}
@@ -0,0 +1,63 @@
+package actor
+
+import (
+	"context"
+)
+
+// Envelope carries information about a message alongside it,
+// without the message itself having to make room.  Messages sent
+// with plain Send() have an empty Envelope.  Headers should not
+// be modified once sent.
+type Envelope struct {
+	Sender        *Actor
+	CorrelationID string
+	Headers       map[string]string
+}
+
+// tEnvelope is how a message sent with SendEnvelope() is queued.
+type tEnvelope struct {
+	e   Envelope
+	msg Msg
+}
+
+// SendEnvelope is Send(), with e delivered alongside msg.  The
+// validator, and any dead letter, sees msg alone.
+func (a *Actor) SendEnvelope(msg Msg, e Envelope) error {
+	err := a.sendQueued(context.Background(), msg,
+		Msg{tEnvelope{e, msg}})
+	if err == errDropped || err == errDeadLettered {
+		return nil
+	}
+	return err
+}
+
+// Tell sends msg to a, with this actor as its Sender(), so that
+// a can answer with Reply().
+func (env *ActorEnv) Tell(a *Actor, msg Msg) error {
+	return a.SendEnvelope(msg, Envelope{Sender: env.This})
+}
+
+// Sender returns the actor which sent the message currently being
+// handled, or nil if it was not sent with Tell() or an Envelope
+// naming a Sender.  Sender must be called from within Receive.
+func (env *ActorEnv) Sender() *Actor {
+	return env.envelope.Sender
+}
+
+// CorrelationID returns the correlation ID in the Envelope of the
+// message currently being handled.
+func (env *ActorEnv) CorrelationID() string {
+	return env.envelope.CorrelationID
+}
+
+// Header returns the header k in the Envelope of the message
+// currently being handled, or "" if it has none.
+func (env *ActorEnv) Header(k string) string {
+	return env.envelope.Headers[k]
+}
+
+// GetEnvelope returns the whole Envelope of the message currently
+// being handled.
+func (env *ActorEnv) GetEnvelope() Envelope {
+	return env.envelope
+}
@@ -0,0 +1,142 @@
+package actor
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Errors with which a Future may resolve.
+var (
+	ErrTimeout     = errors.New("actor: request timed out")
+	ErrActorDead   = errors.New("actor: target actor died")
+	ErrMsgRejected = errors.New("actor: message rejected by validator")
+)
+
+// Future is the pending answer to a request made with Actor.Ask().
+// It resolves exactly once, either to the Msg handed to
+// ActorEnv.Reply() or to an error if the target dies or the
+// timeout elapses first.
+type Future struct {
+	done   chan struct{}
+	once   sync.Once
+	result Msg
+	err    error
+	target *Actor
+}
+
+func newFuture(target *Actor) *Future {
+	return &Future{
+		done:   make(chan struct{}),
+		target: target,
+	}
+}
+
+// Get blocks until the future resolves, and returns the reply
+// or the error which resolved it.
+func (f *Future) Get() (Msg, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// Done returns a channel which is closed once the future has
+// resolved, for use in select statements.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Then returns a new Future which resolves to fn applied to the
+// result of f.  If f resolves to an error, fn is not called and
+// the error is passed along unchanged.
+func (f *Future) Then(fn func(Msg) (Msg, error)) *Future {
+	next := newFuture(nil)
+	go func() {
+		msg, err := f.Get()
+		if err == nil {
+			msg, err = fn(msg)
+		}
+		next.resolve(msg, err)
+	}()
+	return next
+}
+
+// WaitAll blocks until every future has resolved.  The replies
+// are returned in the order of the futures given; the error is
+// the first one encountered in that order, if any.
+func WaitAll(fs ...*Future) ([]Msg, error) {
+	results := make([]Msg, len(fs))
+	var firstErr error
+	for i, f := range fs {
+		msg, err := f.Get()
+		results[i] = msg
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return results, firstErr
+}
+
+// WaitAny blocks until one of the futures has resolved, and
+// returns its index along with its result.  WaitAny() with no
+// futures returns an index of -1.
+func WaitAny(fs ...*Future) (int, Msg, error) {
+	if len(fs) == 0 {
+		return -1, nil, nil
+	}
+	cases := make([]reflect.SelectCase, len(fs))
+	for i, f := range fs {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv,
+			Chan: reflect.ValueOf(f.done)}
+	}
+	i, _, _ := reflect.Select(cases)
+	msg, err := fs[i].Get()
+	return i, msg, err
+}
+
+// resolve settles the future.  Only the first call has any
+// effect, and its return value indicates whether it was that call.
+func (f *Future) resolve(msg Msg, err error) bool {
+	first := false
+	f.once.Do(func() {
+		first = true
+		f.result = msg
+		f.err = err
+		close(f.done)
+		// The target's obit list no longer needs us.  When the
+		// target is the one dying, it is already in die() and
+		// must not be sent anything.
+		if f.target != nil && err != ErrActorDead {
+			go f.target.env.post(f.target.env.cbox, cDelWatcher{f})
+		}
+	})
+	return first
+}
+
+// expireAfter resolves the future with ErrTimeout if nothing
+// else has resolved it within d.  A zero d never expires.
+func (f *Future) expireAfter(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.AfterFunc(d, func() {
+		f.resolve(nil, ErrTimeout)
+	})
+	go func() {
+		<-f.done
+		timer.Stop()
+	}()
+}
+
+// obit makes a Future a valid watcher, so the death of the
+// asked actor resolves the request.
+func (f *Future) obit(deceased *Actor, fname string, reason Reason) {
+	f.resolve(nil, ErrActorDead)
+}
+
+func (f *Future) fullName() string {
+	if f.target == nil {
+		return "(future)"
+	}
+	return f.target.fullName() + "(future)"
+}
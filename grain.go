@@ -0,0 +1,181 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoSuchGrainKind is returned by GrainRef.Send() for a kind
+// never registered with RegisterGrainKind().
+var ErrNoSuchGrainKind = errors.New("actor: no such grain kind")
+
+// ErrGrainNameTaken is returned by GrainRef.Send() when an actor
+// which is not the grain has its name ("kind/id") in the group.
+var ErrGrainNameTaken = errors.New("actor: grain name taken")
+
+// GrainKind describes a kind of virtual actor, or grain.  A grain
+// is addressed by kind and id, and always exists as far as its
+// senders are concerned: it is activated from New(id) by the
+// first message sent to it, passivated (dies normally) once it
+// has had no messages for IdleTimeout, and activated again by
+// the next message.  New must return options with a Receive; a
+// grain which needs state to outlive passivation can be given
+// ActorOptions.Persistence.  An IdleTimeout of zero keeps grains
+// active until they die by other means, after which the next
+// message reactivates them just the same.  The idle clock is the
+// actor's ReceiveTimeout, which IdleTimeout replaces, and whose
+// ReceiveTimeout{} passivates the Receive given; a grain which
+// Become()s something else is not passivated until it Revert()s.
+type GrainKind struct {
+	New         func(id string) *ActorOptions
+	IdleTimeout time.Duration
+}
+
+// GrainRef addresses a grain.  It is cheap to create, and valid
+// whether or not the grain is active.
+type GrainRef struct {
+	ag   *ActorGroup
+	kind string
+	id   string
+}
+
+type tGrainKey struct {
+	kind string
+	id   string
+}
+
+// tGrain is the registry entry of an active grain.  It is entered
+// before its actor is made, so that the group's lock is not held
+// meanwhile; ready is closed once a is set, or left nil if the
+// actor could not be made.  It is the watcher of its actor,
+// removing itself when the actor dies.
+type tGrain struct {
+	ag    *ActorGroup
+	key   tGrainKey
+	a     *Actor
+	ready chan tEmptyStruct
+	gone  chan tEmptyStruct
+}
+
+func (g *tGrain) obit(deceased *Actor, fname string, reason Reason) {
+	g.ag.grainMu.Lock()
+	if g.ag.grains[g.key] == g {
+		delete(g.ag.grains, g.key)
+	}
+	g.ag.grainMu.Unlock()
+	close(g.gone)
+}
+
+// RegisterGrainKind makes kind available to Grain(), replacing
+// any earlier registration.  Grains already active are not
+// affected.
+func (ag *ActorGroup) RegisterGrainKind(kind string, gk GrainKind) {
+	ag.grainMu.Lock()
+	defer ag.grainMu.Unlock()
+	if ag.grainKinds == nil {
+		ag.grainKinds = make(map[string]GrainKind)
+		ag.grains = make(map[tGrainKey]*tGrain)
+	}
+	ag.grainKinds[kind] = gk
+}
+
+// Grain returns a reference to the grain of the given kind and id.
+func (ag *ActorGroup) Grain(kind, id string) *GrainRef {
+	return &GrainRef{ag, kind, id}
+}
+
+func (gr *GrainRef) name() string {
+	return gr.kind + "/" + gr.id
+}
+
+// Send sends msg to the grain, activating it if need be.  A
+// message which reaches a grain as it is passivated is handled
+// by its next activation.  Errors are as for Actor.Send(), and
+// ErrNoSuchGrainKind.
+func (gr *GrainRef) Send(msg Msg) error {
+	for {
+		g, err := gr.activation()
+		if err != nil {
+			gr.ag.deadLetter(DeadLetter{msg, nil,
+				gr.ag.fullName() + ":" + gr.name(), err})
+			return err
+		}
+		err = g.a.enqueue(context.Background(), msg, msg)
+		if err == ErrActorDead {
+			<-g.gone // Then activate it again
+			continue
+		}
+		g.a.undelivered(msg, err)
+		if err == errDropped || err == errDeadLettered {
+			return nil
+		}
+		return err
+	}
+}
+
+// activation returns the grain's current activation, creating it
+// if need be.  An activation which is dying is waited for, so
+// that no two are ever alive at once.
+func (gr *GrainRef) activation() (*tGrain, error) {
+	ag := gr.ag
+	key := tGrainKey{gr.kind, gr.id}
+	ag.grainMu.Lock()
+	if g, ok := ag.grains[key]; ok {
+		ag.grainMu.Unlock()
+		<-g.ready
+		if g.a == nil {
+			return nil, ErrActorDead
+		}
+		return g, nil
+	}
+	gk, ok := ag.grainKinds[gr.kind]
+	if !ok {
+		ag.grainMu.Unlock()
+		return nil, ErrNoSuchGrainKind
+	}
+	g := &tGrain{ag: ag, key: key, ready: make(chan tEmptyStruct),
+		gone: make(chan tEmptyStruct)}
+	ag.grains[key] = g
+	ag.grainMu.Unlock()
+	defer close(g.ready)
+	// An earlier activation has left the guardian before its entry
+	// goes (see die()), so any actor of this name is not one
+	g.a = ag.guardian.env.NewNamedOptionedActor(gr.name(),
+		grainOptions(gk, gr.id))
+	if g.a == nil {
+		ag.grainMu.Lock()
+		if ag.grains[key] == g {
+			delete(ag.grains, key)
+		}
+		ag.grainMu.Unlock()
+		if ag.guardian.env.findChild(gr.name()) != nil {
+			return nil, ErrGrainNameTaken
+		}
+		return nil, ErrActorDead
+	}
+	g.a.watch(g)
+	return g, nil
+}
+
+// grainOptions wraps the grain's Receive to passivate it when
+// idle.
+func grainOptions(gk GrainKind, id string) *ActorOptions {
+	aO := *gk.New(id)
+	if gk.IdleTimeout <= 0 {
+		return &aO
+	}
+	receive := aO.Receive
+	aO.ReceiveTimeout = gk.IdleTimeout
+	aO.Receive = func(msg Msg, env *ActorEnv) {
+		if len(msg) > 0 {
+			if _, ok := msg[0].(ReceiveTimeout); ok {
+				dlog(env, "passivating")
+				env.Suicide()
+				return
+			}
+		}
+		receive(msg, env)
+	}
+	return &aO
+}
@@ -0,0 +1,331 @@
+package actor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// DefaultSegmentSize is the SegmentSize of a FileJournal left at
+// zero.
+const DefaultSegmentSize = 4 << 20
+
+// DefaultMaxOpenSegments is the MaxOpenSegments of a FileJournal
+// left at zero.
+const DefaultMaxOpenSegments = 64
+
+// ErrJournalCorrupt is returned when a FileJournal cannot make
+// sense of what it has stored.
+var ErrJournalCorrupt = errors.New("actor: journal corrupt")
+
+// FileJournal is a Journal kept in a directory.  Each persistence
+// ID has a directory of its own, holding its events in
+// append-only segment files, and its latest snapshot.  Events
+// and states are encoded with encoding/gob, so their concrete
+// types must be registered with gob.Register().
+//
+// A record left half written (by a crash, say) at the end of the
+// last segment is ignored, and overwritten by the next Append().
+//
+// The segment being appended to is kept open for each ID, up to
+// MaxOpenSegments; beyond that, the least recently appended to is
+// closed, and reopened when it is next needed.
+type FileJournal struct {
+	Dir             string
+	SegmentSize     int64 // Bytes before a new segment is begun
+	MaxOpenSegments int
+	mu              sync.Mutex
+	segments        map[string]*tSegment // Open for appending, by ID
+	appends         uint64               // Count, to order segments by use
+}
+
+// tSegment is the segment file being appended to.
+type tSegment struct {
+	f        *os.File
+	size     int64
+	lastUsed uint64 // appends when last appended to
+}
+
+type tJournalRecord struct {
+	Seq   uint64
+	Event interface{}
+}
+
+type tSnapshotRecord struct {
+	Seq   uint64
+	State interface{}
+}
+
+// NewFileJournal returns a FileJournal in dir, creating it if
+// need be.
+func NewFileJournal(dir string) (*FileJournal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileJournal{Dir: dir}, nil
+}
+
+func (j *FileJournal) idDir(id string) string {
+	return filepath.Join(j.Dir, url.PathEscape(id))
+}
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%020d.seg", first)
+}
+
+// segmentFiles lists the segments of id, oldest first.
+func (j *FileJournal) segmentFiles(id string) ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(j.idDir(id), "*.seg"))
+	sort.Strings(names)
+	return names, err
+}
+
+// Append implements Journal.
+func (j *FileJournal) Append(id string, seq uint64,
+	event interface{}) error {
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4)) // Length, filled in below
+	err := gob.NewEncoder(&buf).Encode(tJournalRecord{seq, event})
+	if err != nil {
+		return err
+	}
+	rec := buf.Bytes()
+	binary.BigEndian.PutUint32(rec, uint32(len(rec)-4))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	seg, err := j.segmentFor(id, seq)
+	if err != nil {
+		return err
+	}
+	j.appends++
+	seg.lastUsed = j.appends
+	if _, err = seg.f.WriteAt(rec, seg.size); err != nil {
+		return err
+	}
+	seg.size += int64(len(rec))
+	return seg.f.Sync()
+}
+
+// segmentFor returns the segment to which event seq of id should
+// be appended.  It must be called with mu held.
+func (j *FileJournal) segmentFor(id string, seq uint64) (*tSegment,
+	error) {
+
+	if j.segments == nil {
+		j.segments = make(map[string]*tSegment)
+	}
+	limit := j.SegmentSize
+	if limit <= 0 {
+		limit = DefaultSegmentSize
+	}
+	seg := j.segments[id]
+	if seg == nil {
+		j.closeIdle()
+		if err := os.MkdirAll(j.idDir(id), 0755); err != nil {
+			return nil, err
+		}
+		names, err := j.segmentFiles(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) > 0 {
+			seg, err = openSegment(names[len(names)-1])
+			if err != nil {
+				return nil, err
+			}
+			j.segments[id] = seg
+		}
+	}
+	if seg != nil && seg.size < limit {
+		return seg, nil
+	}
+	if seg != nil {
+		seg.f.Close()
+	}
+	f, err := os.OpenFile(filepath.Join(j.idDir(id), segmentName(seq)),
+		os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		delete(j.segments, id)
+		return nil, err
+	}
+	seg = &tSegment{f: f}
+	j.segments[id] = seg
+	return seg, nil
+}
+
+// closeIdle closes the least recently used segments, to leave room
+// for one more below MaxOpenSegments.  It must be called with mu
+// held.
+func (j *FileJournal) closeIdle() {
+	most := j.MaxOpenSegments
+	if most <= 0 {
+		most = DefaultMaxOpenSegments
+	}
+	for len(j.segments) >= most {
+		var idle string
+		for id, seg := range j.segments {
+			if idle == "" || seg.lastUsed < j.segments[idle].lastUsed {
+				idle = id
+			}
+		}
+		j.segments[idle].f.Close()
+		delete(j.segments, idle)
+	}
+}
+
+// openSegment opens an existing segment for appending, after its
+// last whole record.
+func openSegment(name string) (*tSegment, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := scanSegment(f, nil)
+	if err == nil {
+		err = f.Truncate(size) // Any torn record
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &tSegment{f: f, size: size}, nil
+}
+
+// scanSegment reads the records of a segment, passing each to fn
+// if it is not nil, and returns the length of the whole records.
+func scanSegment(f *os.File, fn func(tJournalRecord)) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var size int64
+	var hdr [4]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return size, nil // Clean end, or a torn header
+		}
+		body := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return size, nil // Torn record
+		}
+		if fn != nil {
+			var rec tJournalRecord
+			err := gob.NewDecoder(bytes.NewReader(body)).Decode(&rec)
+			if err != nil {
+				return size, fmt.Errorf("%w: %s: %v",
+					ErrJournalCorrupt, f.Name(), err)
+			}
+			fn(rec)
+		}
+		size += int64(len(hdr) + len(body))
+	}
+}
+
+// Replay implements Journal.
+func (j *FileJournal) Replay(id string, from uint64,
+	fn func(seq uint64, event interface{})) error {
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	names, err := j.segmentFiles(id)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		if i+1 < len(names) {
+			var next uint64
+			fmt.Sscanf(filepath.Base(names[i+1]), "%d.seg", &next)
+			if next <= from {
+				continue // Wholly before from
+			}
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		_, err = scanSegment(f, func(rec tJournalRecord) {
+			if rec.Seq >= from {
+				fn(rec.Seq, rec.Event)
+			}
+		})
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot implements Journal.  Only the latest snapshot is
+// kept.
+func (j *FileJournal) SaveSnapshot(id string, seq uint64,
+	state interface{}) error {
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(tSnapshotRecord{seq, state})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(j.idDir(id), 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(j.idDir(id), "snapshot")
+	tmp, err := os.CreateTemp(j.idDir(id), "snapshot-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(buf.Bytes()); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// LoadSnapshot implements Journal.
+func (j *FileJournal) LoadSnapshot(id string) (uint64, interface{},
+	bool, error) {
+
+	data, err := os.ReadFile(filepath.Join(j.idDir(id), "snapshot"))
+	if os.IsNotExist(err) {
+		return 0, nil, false, nil
+	}
+	if err != nil {
+		return 0, nil, false, err
+	}
+	var rec tSnapshotRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil {
+		return 0, nil, false, fmt.Errorf("%w: %s snapshot: %v",
+			ErrJournalCorrupt, id, err)
+	}
+	return rec.Seq, rec.State, true, nil
+}
+
+// Close closes the segments open for appending.  The journal may
+// still be used afterwards; they are reopened as needed.
+func (j *FileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var errs []error
+	for id, seg := range j.segments {
+		errs = append(errs, seg.f.Close())
+		delete(j.segments, id)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,78 @@
+package actor
+
+import (
+	"runtime/debug"
+)
+
+// Starter is implemented by an ActorClass which needs to prepare
+// before handling messages.  PreStart is called once the actor
+// is alive, before its first message (including any
+// ActorOptions.FirstMessage).  A panic in PreStart is reported to
+// the parent as a ChildDied, as a panic in Receive would be.
+type Starter interface {
+	PreStart(env *ActorEnv)
+}
+
+// Stopper is implemented by an ActorClass which must clean up
+// when its actor dies.  PostStop is called however the actor
+// dies, once it will handle no more messages and its children
+// have died, but before any Obit is sent.  For a killed actor, it
+// may run while an abandoned Receive is still running.
+type Stopper interface {
+	PostStop(env *ActorEnv)
+}
+
+// Restarter is implemented by an ActorClass which needs to know
+// when its actor is being stopped by its supervisor to be
+// restarted.  PreRestart is called just before PostStop, with the
+// reason the actor is being stopped.  The replacement actor is
+// made from the same ActorClass object.
+type Restarter interface {
+	PreRestart(env *ActorEnv, reason Reason)
+}
+
+// runStart runs any PreStart hook as though it were the first
+// message, telling mainLoop() when Receive is free to start.
+func (env *ActorEnv) runStart() {
+	s, ok := env.class.(Starter)
+	if !ok {
+		env.sbox <- sReceiveFinished{}
+		return
+	}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				dlog(env, "PreStart panicked: ", r)
+				env.Return(Msg{ChildDied{r, env.This, nil,
+					debug.Stack()}})
+			}
+			env.post(env.sbox, sReceiveFinished{})
+		}()
+		s.PreStart(env)
+	}()
+}
+
+// runStop runs the PreRestart and PostStop hooks, as applicable.
+// This is called from die(), after the mailbox is closed and the
+// children are dead, but while the control and state boxes are
+// still open and answered, so GetChildren() and the like work from
+// a PostStop.
+func (env *ActorEnv) runStop() {
+	defer errLogWithText(env, "stop hook panicked: ")
+	if r, ok := env.class.(Restarter); ok && env.forRestart {
+		r.PreRestart(env, env.exitReason)
+	}
+	if s, ok := env.class.(Stopper); ok {
+		s.PostStop(env)
+	}
+}
+
+// classFromSetup makes the ActorClass for an actor, taking the
+// SetupFunc's parameter from ch if given.
+func classFromSetup(suf SetupFunc, ch chan interface{}) ActorClass {
+	if ch != nil {
+		param := <-ch
+		return suf(param)
+	}
+	return suf(nil)
+}
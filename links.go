@@ -0,0 +1,66 @@
+package actor
+
+// Link ties the lives of a and other together: when either dies
+// abnormally, the other is sent an exit signal carrying the same
+// reason.  An actor receiving an exit signal dies with that
+// reason in turn (passing it along its own links), unless it
+// traps exits -- see ActorEnv.TrapExits().
+//
+// Which deaths are abnormal is given by Reason.Abnormal().  Linking
+// an actor which has already died, either way round, gives the
+// other an immediate exit signal.
+func (a *Actor) Link(other *Actor) {
+	if a == other {
+		return
+	}
+	// Each side checks, as it records the link, that the other is
+	// alive; see linked()
+	a.env.post(a.env.cbox, cLink{other, true})
+	other.env.post(other.env.cbox, cLink{a, true})
+}
+
+// Unlink undoes Link.
+func (a *Actor) Unlink(other *Actor) {
+	a.env.post(a.env.cbox, cLink{other, false})
+	other.env.post(other.env.cbox, cLink{a, false})
+}
+
+// exitSignal tells a that a linked actor has died.
+func (a *Actor) exitSignal(from *Actor, reason Reason) {
+	a.env.post(a.env.cbox, cExitSignal{from, reason})
+}
+
+// TrapExits(true) has the exit signals of linked actors delivered
+// to Receive as Exit messages, instead of killing the actor.  An
+// actor trapping exits also hears of linked actors which die
+// normally.
+func (env *ActorEnv) TrapExits(trap bool) {
+	env.post(env.cbox, cTrapExits{trap})
+}
+
+// linked records a link to a.  An a which has already died may
+// have sent its exit signal before the link was recorded, when it
+// was dropped; it is given again here, and any which follows is
+// dropped in its turn.
+// This runs singly from mainLoop(), no race conditions
+func (env *ActorEnv) linked(a *Actor) {
+	env.This.links[a] = tEmptyStruct{}
+	if a.env.closed() {
+		env.exitSignalled(cExitSignal{a, a.env.exitReason})
+	}
+}
+
+// exitSignalled handles the death of a linked actor.
+// This runs singly from mainLoop(), no race conditions
+func (env *ActorEnv) exitSignalled(m cExitSignal) {
+	if _, ok := env.This.links[m.from]; !ok {
+		return // Unlinked since
+	}
+	delete(env.This.links, m.from)
+	if env.trapExits {
+		env.mbox.put(Msg{Exit{m.from, m.reason}}, true)
+	} else if m.reason.Abnormal() {
+		dlog(env, "linked actor ", m.from.fullName(), " died, following")
+		go env.exit(m.reason)
+	}
+}
@@ -0,0 +1,180 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrMailboxFull is returned by Send() when a bounded mailbox
+// turns a message away.
+var ErrMailboxFull = errors.New("actor: mailbox full")
+
+// errDropped and errDeadLettered are how put() reports a message
+// discarded by DropNewest and ToDeadLetters, which Send() does
+// not pass on.
+var (
+	errDropped      = errors.New("actor: message dropped")
+	errDeadLettered = errors.New("actor: message dead lettered")
+)
+
+// OverflowPolicy determines what a bounded mailbox does with a
+// message which arrives when it is already full.
+type OverflowPolicy int
+
+const (
+	// Block makes Send() wait until there is room.  An actor
+	// which sends to itself with this policy can deadlock.
+	Block OverflowPolicy = iota
+	// DropNewest silently discards the arriving message.
+	DropNewest
+	// DropOldest discards the oldest queued message to make room
+	// for the arriving one.
+	DropOldest
+	// Reject discards the arriving message, and tells the sender
+	// by returning ErrMailboxFull from Send().
+	Reject
+	// ToDeadLetters sends the arriving message to the group's
+	// dead letter office instead.
+	ToDeadLetters
+)
+
+// Mailbox configures the queue of messages waiting for an actor's
+// Receive.  The zero Mailbox is unbounded.  Set it with
+// ActorOptions.Mailbox.
+type Mailbox struct {
+	Capacity int // Zero means unbounded
+	Policy   OverflowPolicy
+}
+
+// tMailbox holds an actor's pending messages.  Senders add to it
+// directly, so that messages from any one sender are queued in
+// the order sent; mainLoop() is told of new mail on ready.
+type tMailbox struct {
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	queue    []Msg
+	capacity int
+	policy   OverflowPolicy
+	closed   bool
+	ready    chan tEmptyStruct
+}
+
+func newMailbox() *tMailbox {
+	mb := &tMailbox{ready: make(chan tEmptyStruct, 1)}
+	mb.notFull = sync.NewCond(&mb.mu)
+	return mb
+}
+
+func (mb *tMailbox) configure(m Mailbox) {
+	mb.mu.Lock()
+	mb.capacity = m.Capacity
+	mb.policy = m.Policy
+	mb.mu.Unlock()
+	mb.notFull.Broadcast()
+}
+
+// put queues msg according to the overflow policy.  System
+// messages are queued with force, which ignores the capacity.
+func (mb *tMailbox) put(msg Msg, force bool) error {
+	return mb.putCtx(context.Background(), msg, force)
+}
+
+// putCtx is put(), except that a Block mailbox gives up waiting
+// for room when ctx ends, returning ctx.Err().
+func (mb *tMailbox) putCtx(ctx context.Context, msg Msg,
+	force bool) error {
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.closed {
+		return ErrActorDead
+	}
+	var stop func() bool
+	for !force && mb.full() {
+		switch mb.policy {
+		case Block:
+			if stop == nil && ctx.Done() != nil {
+				stop = context.AfterFunc(ctx, func() {
+					mb.mu.Lock()
+					mb.notFull.Broadcast()
+					mb.mu.Unlock()
+				})
+				defer stop()
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			mb.notFull.Wait()
+			if mb.closed {
+				return ErrActorDead
+			}
+			continue
+		case DropNewest:
+			return errDropped
+		case DropOldest:
+			mb.queue[0] = nil
+			mb.queue = mb.queue[1:]
+		case Reject:
+			return ErrMailboxFull
+		case ToDeadLetters:
+			return errDeadLettered
+		}
+	}
+	mb.queue = append(mb.queue, msg)
+	select {
+	case mb.ready <- tEmptyStruct{}:
+	default:
+	}
+	return nil
+}
+
+// unget puts msgs back at the front of the queue, in order,
+// regardless of capacity or whether the mailbox is closed; they
+// were accepted once already.
+func (mb *tMailbox) unget(msgs []Msg) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	queue := make([]Msg, 0, len(msgs)+len(mb.queue))
+	queue = append(queue, msgs...)
+	mb.queue = append(queue, mb.queue...)
+	select {
+	case mb.ready <- tEmptyStruct{}:
+	default:
+	}
+}
+
+// get removes the oldest message, if there is one.
+func (mb *tMailbox) get() (Msg, bool) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if len(mb.queue) == 0 {
+		return nil, false
+	}
+	msg := mb.queue[0]
+	mb.queue[0] = nil
+	mb.queue = mb.queue[1:]
+	// Not Signal(), as the waiter woken may have given up
+	mb.notFull.Broadcast()
+	return msg, true
+}
+
+func (mb *tMailbox) len() int {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return len(mb.queue)
+}
+
+// close turns away all further messages, but leaves those already
+// queued to be processed.
+func (mb *tMailbox) close() {
+	mb.mu.Lock()
+	mb.closed = true
+	mb.mu.Unlock()
+	mb.notFull.Broadcast()
+}
+
+// full must be called with mu held.
+func (mb *tMailbox) full() bool {
+	return mb.capacity > 0 && len(mb.queue) >= mb.capacity
+}
@@ -0,0 +1,177 @@
+package actor
+
+import (
+	"fmt"
+	"iter"
+	"runtime"
+)
+
+// MapResult is the outcome of ParallelMap's fn for the item at
+// Index (counting from zero) of its input.
+type MapResult[Out any] struct {
+	Index int
+	Value Out
+	Err   error
+}
+
+// PanicError is the Err of a MapResult whose fn panicked.
+type PanicError struct {
+	Value interface{} // As given to panic()
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("actor: panic: %v", e.Value)
+}
+
+type tMapItem[In any] struct {
+	index int
+	in    In
+}
+
+// tMapFarm is the FarmClass of a ParallelMap.  Results are passed
+// to out, until stop is closed.  Workers pass their own, so that
+// each is busy until its result is taken.
+type tMapFarm[In, Out any] struct {
+	fn   func(In) (Out, error)
+	out  chan MapResult[Out]
+	stop chan tEmptyStruct
+	FarmInfo
+}
+
+func (f *tMapFarm[In, Out]) GenWorker() interface{} {
+	return func(msg Msg, env *ActorEnv) {
+		item := msg[0].(tMapItem[In])
+		v, err := f.fn(item.in)
+		f.send(MapResult[Out]{item.index, v, err})
+	}
+}
+
+func (f *tMapFarm[In, Out]) GenFarmer() FarmReceive {
+	return func(msg Msg, env *ActorEnv, dispatch DispatchFn) {
+		switch m := msg[0].(type) {
+		case ChildDied:
+			if len(m.Message) == 0 {
+				return
+			}
+			item, ok := m.Message[0].(tMapItem[In])
+			if !ok {
+				return
+			}
+			f.send(MapResult[Out]{Index: item.index,
+				Err: &PanicError{m.Err, m.Stack}})
+		case WorkComplete:
+			close(f.out)
+			env.Suicide()
+		}
+	}
+}
+
+func (f *tMapFarm[In, Out]) send(r MapResult[Out]) {
+	select {
+	case f.out <- r:
+	case <-f.stop:
+	}
+}
+
+// ParallelMap applies fn to each of items on a farm of workers in
+// ag, yielding the results as they are ready.  A fn which panics
+// yields a *PanicError.  The farm is started when the result is
+// ranged over, and torn down if the range stops early.  A
+// workers of zero or less uses runtime.GOMAXPROCS(0).
+//
+// items are taken only as workers are ready for them, so that
+// no more than a few times workers are held at once, however many
+// there are.  If the farm cannot be started, as when ag is
+// shutting down, a single result is yielded, with an Index of -1
+// and an Err of ErrActorDead.
+func ParallelMap[In, Out any](ag *ActorGroup, items iter.Seq[In],
+	fn func(In) (Out, error), workers int) iter.Seq[MapResult[Out]] {
+
+	return func(yield func(MapResult[Out]) bool) {
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		tasks := func(yield func(Msg) bool) {
+			i := 0
+			for in := range items {
+				if !yield(Msg{tMapItem[In]{i, in}}) {
+					return
+				}
+				i++
+			}
+		}
+		f := &tMapFarm[In, Out]{
+			fn:   fn,
+			out:  make(chan MapResult[Out], workers),
+			stop: make(chan tEmptyStruct),
+			FarmInfo: FarmInfo{
+				MaxWorkers: workers,
+				Mode:       WorkerPool,
+				Source:     SourceFromSeq(tasks),
+			},
+		}
+		farmer := ag.NewActorFarm(f)
+		if farmer == nil {
+			yield(MapResult[Out]{Index: -1, Err: ErrActorDead})
+			return
+		}
+		defer farmer.Die()
+		defer close(f.stop)
+		for r := range f.out {
+			if !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// ParallelMapOrdered is ParallelMap(), except that the results
+// are yielded in the order of items.  Results which are ready out
+// of turn are held until they are due.  No more than a window of a
+// few times workers are taken from items ahead of the one due, so
+// that a slow item holds up the rest rather than letting them pile
+// up.
+func ParallelMapOrdered[In, Out any](ag *ActorGroup, items iter.Seq[In],
+	fn func(In) (Out, error), workers int) iter.Seq[MapResult[Out]] {
+
+	return func(yield func(MapResult[Out]) bool) {
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		// A slot is taken for each item, and given back as its
+		// result is yielded.
+		window := make(chan tEmptyStruct, 4*workers)
+		done := make(chan tEmptyStruct)
+		gated := func(yield func(In) bool) {
+			for in := range items {
+				select {
+				case window <- tEmptyStruct{}:
+				case <-done:
+					return
+				}
+				if !yield(in) {
+					return
+				}
+			}
+		}
+		held := make(map[int]MapResult[Out])
+		next := 0
+		for r := range ParallelMap(ag, gated, fn, workers) {
+			if r.Index < 0 {
+				yield(r) // Not started
+				return
+			}
+			held[r.Index] = r
+			for due, ok := held[next]; ok; due, ok = held[next] {
+				delete(held, next)
+				next++
+				<-window
+				if !yield(due) {
+					close(done) // Before the farm is torn down
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package actor
+
+import (
+	"errors"
+)
+
+// ErrNotPersistent is returned by Persist() and SaveSnapshot()
+// for an actor created without ActorOptions.Persistence.
+var ErrNotPersistent = errors.New("actor: actor is not persistent")
+
+// ErrNoInit is the error with which recovery fails for a
+// Persistence without an Init.
+var ErrNoInit = errors.New("actor: Persistence has no Init")
+
+// Journal stores the events, and snapshots, of persistent actors,
+// each under its own persistence ID.  FileJournal is provided;
+// anything else which can store events in order may be used.
+type Journal interface {
+	// Append stores event as number seq for id.  Events are
+	// numbered from 1, and appended in order.
+	Append(id string, seq uint64, event interface{}) error
+	// Replay calls fn for each event of id numbered from on, in
+	// order.
+	Replay(id string, from uint64,
+		fn func(seq uint64, event interface{})) error
+	// SaveSnapshot stores state as of event seq.
+	SaveSnapshot(id string, seq uint64, state interface{}) error
+	// LoadSnapshot returns the latest snapshot, if any.
+	LoadSnapshot(id string) (seq uint64, state interface{},
+		ok bool, err error)
+}
+
+// Persistence makes an actor event sourced.  Its Receive records
+// each change to its state as an event with ActorEnv.Persist(),
+// and when the actor is created (or restarted by its supervisor)
+// its state is rebuilt: Init resets it, Restore is given the
+// latest snapshot, and Recover each event persisted since, before
+// the actor receives any mail.  Init is required, as a restarted
+// actor is made from the same ActorOptions, whose closures still
+// hold the state of the run which failed.  If recovery fails, the
+// actor is not created.
+//
+// Every SnapshotEvery events, the state returned by Snapshot is
+// saved, so that recovery need not replay every event ever
+// persisted.  Snapshot and Restore may be nil if SnapshotEvery is
+// zero and ActorEnv.SaveSnapshot() is never called.
+type Persistence struct {
+	Journal       Journal
+	ID            string // Defaults to the actor's full name
+	Init          func()
+	Recover       func(event interface{})
+	SnapshotEvery int
+	Snapshot      func() interface{}
+	Restore       func(state interface{})
+}
+
+// tPersistState is kept by the env of a persistent actor.
+type tPersistState struct {
+	p       *Persistence
+	id      string
+	seq     uint64 // Last event persisted
+	snapSeq uint64 // Event of the last snapshot
+}
+
+// recoverState replays the actor's journal.  It runs before the
+// actor is active.
+func (env *ActorEnv) recoverState(p *Persistence) error {
+	if p.Init == nil {
+		return ErrNoInit
+	}
+	ps := &tPersistState{p: p, id: p.ID}
+	if ps.id == "" {
+		ps.id = env.This.fullName()
+	}
+	p.Init()
+	seq, state, ok, err := p.Journal.LoadSnapshot(ps.id)
+	if err != nil {
+		return err
+	}
+	if ok {
+		p.Restore(state)
+		ps.seq, ps.snapSeq = seq, seq
+	}
+	err = p.Journal.Replay(ps.id, ps.seq+1,
+		func(seq uint64, event interface{}) {
+			p.Recover(event)
+			ps.seq = seq
+		})
+	if err != nil {
+		return err
+	}
+	dlog(env, "recovered ", ps.id, " to event ", ps.seq)
+	env.persist = ps
+	return nil
+}
+
+// Persist appends event to the actor's journal, and once it is
+// stored calls handler with it, which should apply it to the
+// actor's state exactly as Persistence.Recover would.  If the
+// journal fails, the error is returned and handler is not
+// called.  Persist must be called from within Receive.
+func (env *ActorEnv) Persist(event interface{},
+	handler func(event interface{})) error {
+
+	ps := env.persist
+	if ps == nil {
+		return ErrNotPersistent
+	}
+	if err := ps.p.Journal.Append(ps.id, ps.seq+1, event); err != nil {
+		return err
+	}
+	ps.seq++
+	if handler != nil {
+		handler(event)
+	}
+	if ps.p.SnapshotEvery > 0 &&
+		ps.seq-ps.snapSeq >= uint64(ps.p.SnapshotEvery) {
+
+		if err := env.SaveSnapshot(); err != nil {
+			elog(env, "failed to save snapshot:", err)
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot saves the state returned by Persistence.Snapshot
+// straight away.  It must be called from within Receive.
+func (env *ActorEnv) SaveSnapshot() error {
+	ps := env.persist
+	if ps == nil {
+		return ErrNotPersistent
+	}
+	err := ps.p.Journal.SaveSnapshot(ps.id, ps.seq, ps.p.Snapshot())
+	if err == nil {
+		ps.snapSeq = ps.seq
+	}
+	return err
+}
+
+// LastSequenceNr returns the number of the last event persisted
+// by the actor, or recovered.
+func (env *ActorEnv) LastSequenceNr() uint64 {
+	if env.persist == nil {
+		return 0
+	}
+	return env.persist.seq
+}
@@ -0,0 +1,71 @@
+package actor
+
+import (
+	"fmt"
+)
+
+// ReasonKind says broadly why an actor died.
+type ReasonKind int
+
+const (
+	Normal   ReasonKind = iota // Suicide() or Die()
+	Shutdown                   // Its parent was dying
+	AgedOut                    // ActorOptions.AgeOut passed
+	Panic                      // Stopped by its supervisor after a panic
+	Killed                     // Killed outright
+	Exited                     // ActorEnv.Exit(), or a linked actor's exit
+)
+
+var reasonKindNames = []string{"normal", "shutdown", "aged out", "panic",
+	"killed", "exited"}
+
+func (k ReasonKind) String() string {
+	if k < 0 || int(k) >= len(reasonKindNames) {
+		return fmt.Sprintf("ReasonKind(%d)", int(k))
+	}
+	return reasonKindNames[k]
+}
+
+// Reason is why an actor died, as given in its Obit and to the
+// actors linked to it.  Value is the panic value for a Panic, and
+// the value given to ActorEnv.Exit() for Exited.  Stack is the
+// stack trace of a Panic.
+type Reason struct {
+	Kind  ReasonKind
+	Value interface{}
+	Stack []byte
+}
+
+// Abnormal reports whether the death should bring down linked
+// actors: a Panic, Killed or Exited.  An actor dying because its
+// parent is shutting down dies normally.
+func (r Reason) Abnormal() bool {
+	return r.Kind == Panic || r.Kind == Killed || r.Kind == Exited
+}
+
+func (r Reason) String() string {
+	if r.Value == nil {
+		return r.Kind.String()
+	}
+	return fmt.Sprintf("%s: %v", r.Kind, r.Value)
+}
+
+// Exit has the actor die gracefully, as Suicide() does, but
+// abnormally, with an Exited Reason carrying v.  Actors linked to
+// it are brought down with the same Reason.  An Exit(nil) is a
+// normal death, the same as Suicide().
+func (env *ActorEnv) Exit(v interface{}) {
+	if v == nil {
+		env.exit(Reason{Kind: Normal})
+		return
+	}
+	env.exit(Reason{Kind: Exited, Value: v})
+}
+
+// exit has the actor die gracefully, as Suicide() does, but for
+// the given reason.
+func (env *ActorEnv) exit(reason Reason) {
+	if !env.post(env.sbox, sExit{reason, false}) {
+		dlog(env, "is already dead")
+	}
+}
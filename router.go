@@ -0,0 +1,322 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// ErrNoRoutees is the Reason given to the dead letter office for a
+// message sent to a router with no routees left.
+var ErrNoRoutees = errors.New("actor: router has no routees")
+
+// Routing is the strategy by which a router picks the routee of
+// each message.
+type Routing int
+
+const (
+	// RoundRobin sends to each routee in turn.
+	RoundRobin Routing = iota
+	// Random sends to a routee picked at random.
+	Random
+	// Broadcast sends every message to all the routees.
+	Broadcast
+	// SmallestMailbox sends to the routee with the fewest
+	// messages waiting.
+	SmallestMailbox
+	// ConsistentHash sends all messages with the same
+	// RouterOptions.HashKey to the same routee, for as long as the
+	// routees stay the same.  Adding or removing a routee moves
+	// only the keys that must move.
+	ConsistentHash
+)
+
+// DefaultVirtualNodes is the VirtualNodes of a ConsistentHash
+// router left at zero.
+const DefaultVirtualNodes = 100
+
+// RouterOptions configures a router, made with NewRouter().  The
+// routees are either the actors listed in Routees, or Size
+// children of the router spawned with Spawn; the latter are the
+// only ones resized by ResizePool.
+//
+// A router forwards messages as it received them, so a routee
+// can Reply() to an Ask() of the router, and sees the envelope of
+// a SendEnvelope().  Routees which die are dropped from the
+// router; a message for which no routee is left goes to the dead
+// letter office with ErrNoRoutees.  A spawned routee which panics
+// is replaced; framework messages such as ChildDied, Exit and
+// ReceiveTimeout are never routed.
+type RouterOptions struct {
+	Routing      Routing
+	Routees      []*Actor
+	Spawn        ReceiveGenerator
+	Size         int
+	HashKey      func(Msg) string // Needed for ConsistentHash
+	VirtualNodes int              // Ring points per routee
+}
+
+// AddRoutee, sent to a router, adds A to its routees.
+type AddRoutee struct {
+	A *Actor
+}
+
+// RemoveRoutee, sent to a router, removes A from its routees.  A
+// routee the router spawned is also told to die.
+type RemoveRoutee struct {
+	A *Actor
+}
+
+// ResizePool, sent to a router made with RouterOptions.Spawn,
+// spawns or stops routees until it has Size of them.
+type ResizePool struct {
+	Size int
+}
+
+// GetRoutees, sent to a router with Ask(), has the router Reply()
+// with Msg{[]*Actor} of its current routees.
+type GetRoutees struct{}
+
+// tRouter is the ActorClass of a router.  Its state is touched
+// only by its own Receive.
+type tRouter struct {
+	ro      RouterOptions
+	routees []*Actor
+	spawned map[*Actor]tEmptyStruct
+	next    int
+	ring    []uint64 // Sorted points of the hash ring
+	owners  map[uint64]*Actor
+}
+
+// NewRouter creates a router child of the caller.  It returns nil
+// if ro is not usable: ConsistentHash without a HashKey, say.
+func (env *ActorEnv) NewRouter(ro *RouterOptions) *Actor {
+	return env.NewNamedRouter(env.This.Group.getGUID(), ro)
+}
+
+// NewNamedRouter is NewRouter() with a name.
+func (env *ActorEnv) NewNamedRouter(n string, ro *RouterOptions) *Actor {
+	if ro.Routing == ConsistentHash && ro.HashKey == nil {
+		elog(env, "ConsistentHash router needs a HashKey", n)
+		return nil
+	}
+	r := &tRouter{ro: *ro}
+	r.ro.Routees = append([]*Actor(nil), ro.Routees...)
+	return env.NewNamedActorObject(n, r)
+}
+
+// PreStart watches the given routees and spawns the pool.
+func (r *tRouter) PreStart(env *ActorEnv) {
+	env.SetObitForward(true)
+	r.routees = nil // Those of any earlier run are gone
+	r.spawned = make(map[*Actor]tEmptyStruct)
+	for _, a := range r.ro.Routees {
+		r.add(env, a)
+	}
+	if r.ro.Spawn != nil {
+		r.resize(env, r.ro.Size)
+	}
+	r.rebuildRing()
+}
+
+func (r *tRouter) Receive(msg Msg, env *ActorEnv) {
+	switch m := msg[0].(type) {
+	case Obit:
+		r.remove(m.A)
+	case AddRoutee:
+		r.add(env, m.A)
+	case RemoveRoutee:
+		if _, ok := r.spawned[m.A]; ok {
+			m.A.Die()
+		} else {
+			m.A.Unmonitor(env.This)
+		}
+		r.remove(m.A)
+	case ResizePool:
+		if r.ro.Spawn == nil {
+			elog(env, "ResizePool sent to a router without Spawn")
+			return
+		}
+		r.resize(env, m.Size)
+	case GetRoutees:
+		env.Reply(Msg{append([]*Actor(nil), r.routees...)})
+		return
+	case ChildDied:
+		r.replace(env, m)
+	case ReceiveTimeout, Exit:
+		dlog(env, "router dropped", m)
+		return
+	default:
+		r.route(msg, env)
+		return
+	}
+	r.rebuildRing()
+}
+
+func (r *tRouter) add(env *ActorEnv, a *Actor) {
+	if a == nil {
+		return
+	}
+	for _, ra := range r.routees {
+		if ra == a {
+			return
+		}
+	}
+	r.routees = append(r.routees, a)
+	a.Monitor(env.This)
+}
+
+// remove drops a from the routees.  It does not rebuild the ring.
+func (r *tRouter) remove(a *Actor) {
+	for i, ra := range r.routees {
+		if ra == a {
+			r.routees = append(r.routees[:i], r.routees[i+1:]...)
+			break
+		}
+	}
+	delete(r.spawned, a)
+}
+
+// replace stops a spawned routee which panicked, in place of
+// routing its ChildDied, and spawns another in its stead.
+func (r *tRouter) replace(env *ActorEnv, cd ChildDied) {
+	elog(env, "routee", cd.A.Id, "panicked:", cd.Err)
+	if _, ok := r.spawned[cd.A]; !ok {
+		return
+	}
+	size := len(r.spawned)
+	r.remove(cd.A)
+	cd.A.Die()
+	r.resize(env, size)
+}
+
+// resize spawns or stops routees until size of those spawned are
+// left.  The newest are stopped first.
+func (r *tRouter) resize(env *ActorEnv, size int) {
+	for len(r.spawned) < size {
+		a := env.NewActor(r.ro.Spawn())
+		if a == nil {
+			return // Dying
+		}
+		r.spawned[a] = tEmptyStruct{}
+		r.add(env, a)
+	}
+	for i := len(r.routees) - 1; i >= 0 && len(r.spawned) > size; i-- {
+		a := r.routees[i]
+		if _, ok := r.spawned[a]; ok {
+			r.remove(a)
+			a.Die()
+		}
+	}
+}
+
+// route forwards the message being handled, wrapped as it arrived,
+// to the routee or routees the strategy picks.  A routee found to
+// be dead is dropped, and another picked.
+func (r *tRouter) route(msg Msg, env *ActorEnv) {
+	if r.ro.Routing == Broadcast {
+		for _, a := range append([]*Actor(nil), r.routees...) {
+			r.forward(a, msg, env)
+		}
+		if len(r.routees) > 0 {
+			return
+		}
+	}
+	for len(r.routees) > 0 {
+		a := r.pick(msg)
+		if r.forward(a, msg, env) {
+			return
+		}
+	}
+	env.This.Group.deadLetter(DeadLetter{msg, env.This, "",
+		ErrNoRoutees})
+}
+
+// forward returns false if a proved to be dead, having removed
+// it.
+func (r *tRouter) forward(a *Actor, msg Msg, env *ActorEnv) bool {
+	err := a.enqueue(env.Context(), msg, env.current)
+	if err == ErrActorDead {
+		r.remove(a)
+		r.rebuildRing()
+		return false
+	}
+	if err != nil && err != context.Canceled {
+		a.undelivered(msg, err)
+	}
+	return true
+}
+
+func (r *tRouter) pick(msg Msg) *Actor {
+	switch r.ro.Routing {
+	case Random:
+		return r.routees[rand.Intn(len(r.routees))]
+	case SmallestMailbox:
+		best := r.routees[0]
+		least := best.env.mbox.len()
+		for _, a := range r.routees[1:] {
+			if n := a.env.mbox.len(); n < least {
+				best, least = a, n
+			}
+		}
+		return best
+	case ConsistentHash:
+		h := hashString(r.ro.HashKey(msg))
+		i := sort.Search(len(r.ring), func(i int) bool {
+			return r.ring[i] >= h
+		})
+		if i == len(r.ring) {
+			i = 0
+		}
+		return r.owners[r.ring[i]]
+	default:
+		r.next = r.next % len(r.routees)
+		r.next++
+		return r.routees[r.next-1]
+	}
+}
+
+// rebuildRing places VirtualNodes points of each routee on the
+// hash ring, by a hash of its full name.
+func (r *tRouter) rebuildRing() {
+	if r.ro.Routing != ConsistentHash {
+		return
+	}
+	vn := r.ro.VirtualNodes
+	if vn <= 0 {
+		vn = DefaultVirtualNodes
+	}
+	r.ring = r.ring[:0]
+	r.owners = make(map[uint64]*Actor, vn*len(r.routees))
+	for _, a := range r.routees {
+		name := a.fullName()
+		for i := 0; i < vn; i++ {
+			h := hashString(name + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[h]; taken {
+				continue
+			}
+			r.owners[h] = a
+			r.ring = append(r.ring, h)
+		}
+	}
+	sort.Slice(r.ring, func(i, j int) bool { return r.ring[i] < r.ring[j] })
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// NewRouter is a pass-thru function to actor.NewRouter
+func (ag *ActorGroup) NewRouter(ro *RouterOptions) *Actor {
+	return ag.guardian.env.NewRouter(ro)
+}
+
+// NewNamedRouter is a pass-thru function to actor.NewNamedRouter
+func (ag *ActorGroup) NewNamedRouter(n string, ro *RouterOptions) *Actor {
+	return ag.guardian.env.NewNamedRouter(n, ro)
+}
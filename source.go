@@ -0,0 +1,278 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"github.com/hishboy/gocommons/lang"
+	"io"
+	"iter"
+)
+
+// ErrFarmClosed is the Reason given to the dead letter office for
+// a task dispatched to a farm which takes no more: one which is
+// draining, cancelled or done, or which is fed by a FarmSource.
+var ErrFarmClosed = errors.New("actor: farm takes no dispatched tasks")
+
+// FarmSource supplies the tasks of a farm.  Next blocks until
+// the next task is available, and returns io.EOF once there are
+// no more; this is the one way a source completes.  Any other
+// error also ends the source, and is reported as the SourceErr of
+// WorkComplete.  A farm calls Next from a single goroutine, and
+// only when it has room for the task: while it is not paused, and
+// fewer tasks wait for a worker than it may have workers.  It
+// stops calling Next once it is draining, cancelled or dead, and
+// a source which is also an io.Closer is then closed, from that
+// same goroutine.  A task returned by a Next already under way
+// when the farm is drained is still dispatched, and when it is
+// cancelled is counted in WorkComplete.Dropped.
+type FarmSource interface {
+	Next() (Msg, error)
+}
+
+// FarmSourcer is implemented by a FarmClass which takes its
+// tasks from a FarmSource.  Its DistChan is then not read, and
+// tasks its FarmReceive dispatches go to the dead letter office.
+// A FarmClass which does not is fed by the tasks its FarmReceive
+// dispatches, as they come, and by its DistChan, which is read as
+// a FarmSource is; either completes on a nil Msg or an
+// EndSentinel, and DistChan also on being closed.  DistChan may
+// be nil.
+type FarmSourcer interface {
+	GetSource() FarmSource
+}
+
+// SourceFromSeq returns a FarmSource of the messages of seq.
+func SourceFromSeq(seq iter.Seq[Msg]) FarmSource {
+	return &tSeqSource{seq: seq}
+}
+
+// SourceFromFunc returns a FarmSource which calls next for each
+// task.  next returns io.EOF when there are no more.
+func SourceFromFunc(next func() (Msg, error)) FarmSource {
+	return tFuncSource(next)
+}
+
+// SourceFromChan returns a FarmSource of the messages received
+// from ch, which completes once ch is closed.  If ctx ends first
+// the source ends with ctx.Err().
+func SourceFromChan(ctx context.Context, ch <-chan Msg) FarmSource {
+	return &tChanSource{ctx, ch}
+}
+
+type tSeqSource struct {
+	seq  iter.Seq[Msg]
+	next func() (Msg, bool)
+	stop func()
+}
+
+func (s *tSeqSource) Next() (Msg, error) {
+	if s.next == nil {
+		s.next, s.stop = iter.Pull(s.seq)
+	}
+	m, ok := s.next()
+	if !ok {
+		return nil, io.EOF
+	}
+	return m, nil
+}
+
+func (s *tSeqSource) Close() error {
+	if s.stop != nil {
+		s.stop()
+	}
+	return nil
+}
+
+type tFuncSource func() (Msg, error)
+
+func (f tFuncSource) Next() (Msg, error) {
+	return f()
+}
+
+type tChanSource struct {
+	ctx context.Context
+	ch  <-chan Msg
+}
+
+func (s *tChanSource) Next() (Msg, error) {
+	select {
+	case m, ok := <-s.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return m, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// tDistChanSource is the FarmSource of a farm fed by its
+// DistChan.  Unlike other sources, it stops waiting once the farm
+// stops reading it.
+type tDistChanSource struct {
+	ch   chan Msg
+	stop <-chan tEmptyStruct
+}
+
+func (s tDistChanSource) Next() (Msg, error) {
+	select {
+	case m := <-s.ch:
+		if endsDistChan(m) {
+			return nil, io.EOF
+		}
+		return m, nil
+	case <-s.stop:
+		return nil, errSourceStopped
+	}
+}
+
+// endsDistChan reports whether m, sent on a DistChan or
+// dispatched, completes the farm's input: nil (or the zero Msg of
+// a closed channel), or an EndSentinel.
+func endsDistChan(m Msg) bool {
+	if len(m) == 0 {
+		return true
+	}
+	_, ok := m[0].(EndSentinel)
+	return ok
+}
+
+// errSourceStopped is what a tFarmInput yields for a task asked
+// for as it was stopped.
+var errSourceStopped = errors.New("actor: farm source stopped")
+
+// tSourced is a task, or the error which ended its source.
+type tSourced struct {
+	msg Msg
+	err error
+}
+
+// tFarmInput runs a farm's source, passing a task to the farm's
+// manager on ch each time it is asked with request().  It is used
+// only by the manager, which asks only when it has room for the
+// task, so that a source is never read ahead of the workers.  A
+// task already asked for when the input is stopped is passed on
+// all the same, for the manager to dispatch or drop.
+type tFarmInput struct {
+	want    chan tEmptyStruct
+	ch      chan tSourced
+	stop    chan tEmptyStruct
+	sourced bool // Fed by a FarmSource, not its DistChan
+	pending bool // Asked for a task not yet received
+	stopped bool
+}
+
+func startFarmInput(f FarmClass) *tFarmInput {
+	in := &tFarmInput{
+		want: make(chan tEmptyStruct, 1),
+		ch:   make(chan tSourced, 1),
+		stop: make(chan tEmptyStruct),
+	}
+	var src FarmSource = tDistChanSource{f.GetDistChan(), in.stop}
+	if s, ok := f.(FarmSourcer); ok && s.GetSource() != nil {
+		src = s.GetSource()
+		in.sourced = true
+	}
+	go feedFarm(src, in.want, in.ch, in.stop)
+	return in
+}
+
+// feedFarm answers each request on want with a task, or the error
+// which ended src, on ch.  It checks stop before each pull.
+func feedFarm(src FarmSource, want <-chan tEmptyStruct,
+	ch chan<- tSourced, stop <-chan tEmptyStruct) {
+
+	if c, ok := src.(io.Closer); ok {
+		defer c.Close()
+	}
+	for {
+		select {
+		case <-want:
+		case <-stop:
+			select {
+			case <-want: // Asked for before the stop
+				ch <- tSourced{nil, errSourceStopped}
+			default:
+			}
+			return
+		}
+		select {
+		case <-stop:
+			ch <- tSourced{nil, errSourceStopped}
+			return
+		default:
+		}
+		m, err := src.Next()
+		ch <- tSourced{m, err}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// request asks for the next task, unless one has been asked for
+// already or the input is stopped.
+func (in *tFarmInput) request() {
+	if !in.pending && !in.stopped {
+		in.pending = true
+		in.want <- tEmptyStruct{}
+	}
+}
+
+// received handles what the source passed on ch, queuing a task
+// on msgQ.  It returns true if the source has ended.
+func (in *tFarmInput) received(s tSourced, book *tFarmBook,
+	msgQ *lang.Queue) bool {
+
+	in.pending = false
+	switch {
+	case s.err == errSourceStopped:
+	case s.err != nil:
+		book.sourceEnded(s.err)
+		in.close()
+		return true
+	default:
+		t := book.admit(s.msg)
+		if t != nil && book.done.Cancelled {
+			book.drop(t) // Asked for before the cancel
+		} else if t != nil {
+			msgQ.Push(t)
+		}
+	}
+	return false
+}
+
+// dispatched handles a task dispatched by the farm's FarmReceive,
+// queuing it on msgQ.  It returns true if the task completes the
+// input.  A task the farm cannot take goes to the dead letter
+// office.
+func (in *tFarmInput) dispatched(m Msg, open bool, book *tFarmBook,
+	msgQ *lang.Queue) bool {
+
+	if !open || in.sourced {
+		rejectTask(book.env, m)
+		return false
+	}
+	if endsDistChan(m) {
+		in.close()
+		return true
+	}
+	if t := book.admit(m); t != nil {
+		msgQ.Push(t)
+	}
+	return false
+}
+
+func rejectTask(env *ActorEnv, m Msg) {
+	dlog(env, "farm rejected a dispatched task")
+	env.This.Group.deadLetter(DeadLetter{m, env.This, "", ErrFarmClosed})
+}
+
+// close stops the source.  A task already asked for is still
+// received on ch.
+func (in *tFarmInput) close() {
+	if !in.stopped {
+		in.stopped = true
+		close(in.stop)
+	}
+}
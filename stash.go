@@ -0,0 +1,48 @@
+package actor
+
+import (
+	"errors"
+)
+
+// ErrStashFull is returned by Stash() when the actor already has
+// ActorOptions.StashCapacity messages stashed.
+var ErrStashFull = errors.New("actor: stash full")
+
+// Stash sets aside the message currently being handled, to be
+// handled again after a later UnstashAll().  This lets an actor
+// which is not yet ready for some messages (while waiting to
+// initialize, say) defer them until it has Become() something
+// which is.  A message sent with Ask() may still be answered with
+// Reply() once it is unstashed.  Stash must be called from within
+// Receive.  It returns ErrActorDead from a Receive left running by
+// Kill(), once the actor has died.
+func (env *ActorEnv) Stash() error {
+	if env.current == nil {
+		return nil // Already stashed
+	}
+	env.stashMu.Lock()
+	defer env.stashMu.Unlock()
+	if env.stashShut {
+		return ErrActorDead
+	}
+	if env.stashCap > 0 && len(env.stash) >= env.stashCap {
+		return ErrStashFull
+	}
+	env.stash = append(env.stash, env.current)
+	env.current = nil
+	return nil
+}
+
+// UnstashAll returns all stashed messages to the mailbox, in the
+// order they were stashed, ahead of any mail which has arrived
+// since.  It is usually called just before or after Become() or
+// Revert().  UnstashAll must be called from within Receive.
+func (env *ActorEnv) UnstashAll() {
+	env.stashMu.Lock()
+	defer env.stashMu.Unlock()
+	if len(env.stash) == 0 {
+		return
+	}
+	env.mbox.unget(env.stash)
+	env.stash = nil
+}
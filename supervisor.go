@@ -0,0 +1,186 @@
+package actor
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTooManyRestarts is the Err of the ChildDied a supervisor
+// sends its own parent when its children fail more often than
+// its strategy allows.
+var ErrTooManyRestarts = errors.New("actor: restart intensity exceeded")
+
+// SupervisorStrategy decides what an actor does when one of its
+// children panics, in place of delivering the ChildDied message
+// to Receive.  Set it with ActorOptions.Supervisor.  The
+// strategies provided model those of Erlang/OTP:
+//
+//	OneForOne  -- only the failed child is restarted
+//	OneForAll  -- all children are restarted
+//	RestForOne -- the failed child, and every child created
+//	              after it, are restarted
+//
+// Restarted children are stopped (youngest first), and then
+// recreated, oldest first, under the same name and from the same
+// Receive or ActorOptions as the original.  If more than
+// MaxRestarts restarts are needed within Within (or, when Within
+// is zero, over the supervisor's whole life), the supervisor
+// gives up: it sends its own parent a ChildDied with an Err of
+// ErrTooManyRestarts, and dies.
+type SupervisorStrategy interface {
+	intensity() (int, time.Duration)
+	toRestart(failed string, order []string) []string
+}
+
+// OneForOne restarts only the child which failed.
+type OneForOne struct {
+	MaxRestarts int
+	Within      time.Duration
+}
+
+// OneForAll restarts every child when any one fails.
+type OneForAll struct {
+	MaxRestarts int
+	Within      time.Duration
+}
+
+// RestForOne restarts the failed child, along with all children
+// created after it.
+type RestForOne struct {
+	MaxRestarts int
+	Within      time.Duration
+}
+
+func (s OneForOne) intensity() (int, time.Duration) {
+	return s.MaxRestarts, s.Within
+}
+
+func (s OneForOne) toRestart(failed string, order []string) []string {
+	return []string{failed}
+}
+
+func (s OneForAll) intensity() (int, time.Duration) {
+	return s.MaxRestarts, s.Within
+}
+
+func (s OneForAll) toRestart(failed string, order []string) []string {
+	return order
+}
+
+func (s RestForOne) intensity() (int, time.Duration) {
+	return s.MaxRestarts, s.Within
+}
+
+func (s RestForOne) toRestart(failed string, order []string) []string {
+	for i, n := range order {
+		if n == failed {
+			return order[i:]
+		}
+	}
+	return []string{failed}
+}
+
+// supervise handles a ChildDied on behalf of the supervisor,
+// returning false if it should be delivered to Receive as usual.
+// This runs singly from mainLoop(), no race conditions
+func (env *ActorEnv) supervise(cd ChildDied, dying bool) bool {
+	if env.supervisor == nil || cd.A == nil {
+		return false
+	}
+	if env.This.children[cd.A.Id] != cd.A {
+		// Not one of ours, or already replaced
+		return false
+	}
+	if _, ok := env.restarting[cd.A]; ok || dying {
+		return true
+	}
+	if !env.allowRestart() {
+		elog(env, "restart intensity exceeded, escalating")
+		go env.Return(Msg{ChildDied{ErrTooManyRestarts, env.This, nil,
+			nil}})
+		go env.exit(Reason{Kind: Exited, Value: ErrTooManyRestarts})
+		return true
+	}
+	if env.restarting == nil {
+		env.restarting = make(map[*Actor]tEmptyStruct)
+		env.pending = make(map[string][]Msg)
+	}
+	kids := make([]*Actor, 0)
+	for _, n := range env.supervisor.toRestart(cd.A.Id,
+		env.This.order) {
+
+		if k, ok := env.This.children[n]; ok {
+			if _, busy := env.restarting[k]; !busy {
+				env.restarting[k] = tEmptyStruct{}
+				env.pending[n] = nil
+				kids = append(kids, k)
+			}
+		}
+	}
+	delay := env.nextBackoff(cd.A.Id)
+	dlog(env, "restarting ", len(kids), " children after ", delay)
+	go env.restartChildren(kids, cd, delay)
+	return true
+}
+
+// allowRestart records a restart, and reports whether it is
+// within the supervisor's restart intensity.
+func (env *ActorEnv) allowRestart() bool {
+	max, within := env.supervisor.intensity()
+	now := time.Now()
+	if within > 0 {
+		recent := env.restarts[:0]
+		for _, t := range env.restarts {
+			if now.Sub(t) < within {
+				recent = append(recent, t)
+			}
+		}
+		env.restarts = recent
+	}
+	env.restarts = append(env.restarts, now)
+	return len(env.restarts) <= max
+}
+
+func (env *ActorEnv) restartChildren(kids []*Actor, failed ChildDied,
+	delay time.Duration) {
+
+	for i := len(kids) - 1; i >= 0; i-- {
+		reason := Reason{Kind: Shutdown}
+		if kids[i] == failed.A {
+			reason = Reason{Panic, failed.Err, failed.Stack}
+		}
+		env.stopChild(kids[i], reason)
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	for _, k := range kids {
+		a := env.respawn(k)
+		if a == nil {
+			elog(env, "failed to restart", k.Id)
+		}
+		env.post(env.cbox, cRestarted{k.Id, a})
+	}
+}
+
+// stopChild asks a child to die for reason, and returns once it
+// has.
+func (env *ActorEnv) stopChild(child *Actor, reason Reason) {
+	notice := make(tDeathNotice)
+	child.watch(notice)
+	if !child.env.post(child.env.sbox, sExit{reason, true}) {
+		dlog(child, "is already dead")
+	}
+	<-notice
+}
+
+// respawn creates a new child in the image of old.  Its name has
+// been kept for it since old died, while pending has an entry.
+func (env *ActorEnv) respawn(old *Actor) *Actor {
+	if aO := old.spec.options; aO != nil && aO.Farm != nil {
+		return env.newActorFarm(old.Id, aO, true)
+	}
+	a, _ := env.newChild(old.Id, old.spec.receive, old.spec.options,
+		true)
+	return a
+}
@@ -0,0 +1,173 @@
+package actor
+
+import (
+	"sync"
+	"time"
+)
+
+// TimerRef is returned by the ActorEnv timer functions, and may
+// be used to cancel the timer.
+type TimerRef struct {
+	mu      sync.Mutex
+	t       *time.Timer
+	every   time.Duration // Zero for a one-shot timer
+	stopped bool
+	key     interface{} // nil unless keyed
+	env     *ActorEnv
+}
+
+// Cancel stops the timer.  Once Cancel returns no further
+// messages will be sent by it.  The return is false if the timer
+// had already fired (for a SendAfter) or been canceled.
+func (tr *TimerRef) Cancel() bool {
+	if !tr.stop() {
+		return false
+	}
+	tr.env.timers.forget(tr)
+	return true
+}
+
+func (tr *TimerRef) stop() bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.stopped {
+		return false
+	}
+	tr.stopped = true
+	tr.t.Stop()
+	return true
+}
+
+// fire delivers msg unless the timer has been stopped meanwhile.
+// Timer messages are the actor's own work, already accepted, so
+// they are not subject to the mailbox capacity or validator.
+func (tr *TimerRef) fire(msg Msg) {
+	tr.mu.Lock()
+	if tr.stopped {
+		tr.mu.Unlock()
+		return
+	}
+	tr.env.mbox.put(msg, true)
+	if tr.every > 0 {
+		tr.t.Reset(tr.every)
+		tr.mu.Unlock()
+		return
+	}
+	tr.stopped = true
+	tr.mu.Unlock()
+	tr.env.timers.forget(tr)
+}
+
+// tTimers holds the live timers of an actor.  It is used both
+// from Receive and from the timers' own goroutines.
+type tTimers struct {
+	mu    sync.Mutex
+	refs  map[*TimerRef]tEmptyStruct
+	keyed map[interface{}]*TimerRef
+	dead  bool
+}
+
+func (ts *tTimers) add(tr *TimerRef) bool {
+	ts.mu.Lock()
+	if ts.dead {
+		ts.mu.Unlock()
+		return false
+	}
+	if ts.refs == nil {
+		ts.refs = make(map[*TimerRef]tEmptyStruct)
+		ts.keyed = make(map[interface{}]*TimerRef)
+	}
+	ts.refs[tr] = tEmptyStruct{}
+	var old *TimerRef
+	if tr.key != nil {
+		old = ts.keyed[tr.key]
+		ts.keyed[tr.key] = tr
+		delete(ts.refs, old)
+	}
+	ts.mu.Unlock()
+	if old != nil {
+		old.stop()
+	}
+	return true
+}
+
+func (ts *tTimers) forget(tr *TimerRef) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.refs, tr)
+	if tr.key != nil && ts.keyed[tr.key] == tr {
+		delete(ts.keyed, tr.key)
+	}
+}
+
+func (ts *tTimers) find(key interface{}) *TimerRef {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.keyed[key]
+}
+
+// stopAll cancels every timer, and any set afterwards.
+func (ts *tTimers) stopAll() {
+	ts.mu.Lock()
+	refs := ts.refs
+	ts.refs = nil
+	ts.keyed = nil
+	ts.dead = true
+	ts.mu.Unlock()
+	for tr := range refs {
+		tr.stop()
+	}
+}
+
+func (env *ActorEnv) startTimer(key interface{}, d time.Duration,
+	every time.Duration, msg Msg) *TimerRef {
+
+	tr := &TimerRef{every: every, key: key, env: env}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.t = time.AfterFunc(d, func() { tr.fire(msg) })
+	if !env.timers.add(tr) {
+		tr.stopped = true
+		tr.t.Stop()
+	}
+	return tr
+}
+
+// SendAfter sends msg to the actor itself once d has passed.
+// The timer is canceled if the actor dies first.
+func (env *ActorEnv) SendAfter(d time.Duration, msg Msg) *TimerRef {
+	return env.startTimer(nil, d, 0, msg)
+}
+
+// SendEvery sends msg to the actor itself every d, until the
+// returned TimerRef is canceled or the actor dies.
+func (env *ActorEnv) SendEvery(d time.Duration, msg Msg) *TimerRef {
+	return env.startTimer(nil, d, d, msg)
+}
+
+// SendAfterKeyed is SendAfter, except that the timer is known by
+// key.  Any timer already running under the same key is canceled,
+// so that resetting a timeout is simply a matter of setting it
+// again.
+func (env *ActorEnv) SendAfterKeyed(key interface{}, d time.Duration,
+	msg Msg) *TimerRef {
+
+	return env.startTimer(key, d, 0, msg)
+}
+
+// SendEveryKeyed is SendEvery, with a key as for SendAfterKeyed.
+func (env *ActorEnv) SendEveryKeyed(key interface{}, d time.Duration,
+	msg Msg) *TimerRef {
+
+	return env.startTimer(key, d, d, msg)
+}
+
+// CancelTimer cancels the timer running under key, returning
+// false if there was none.
+func (env *ActorEnv) CancelTimer(key interface{}) bool {
+	tr := env.timers.find(key)
+	if tr == nil {
+		return false
+	}
+	return tr.Cancel()
+}
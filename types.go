@@ -9,7 +9,11 @@ import (
 
 var _DODEBUG = false
 
-const _MBOX_SIZE = 35
+// Ids of the actors each ActorGroup runs for itself
+const (
+	_GUARDIAN    = "GUARDIAN"
+	_DEADLETTERS = "DEADLETTERS"
+)
 
 var debugLog, errorLog, panicLog *log.Logger
 
@@ -34,18 +38,52 @@ func (m Msg) GoString() string {
 // a farmer actor to indicate that all workers have
 // terminated, and no more workers will be created (usually
 // because the channel indicating new works has been closed.)
-type WorkComplete struct{}
+// It accounts for the farm's tasks: a task has Succeeded if its
+// worker finished it without panicking (for a OneShot farm, and
+// then died normally), and Failed if it was given up on.  A
+// farm stopped by CancelFarm is Cancelled, and lists the tasks
+// it dropped, whether queued, being worked on, or being taken from
+// its source as it was cancelled, in Dropped.
+type WorkComplete struct {
+	Dispatched int   // Tasks handed to workers, retries included
+	Succeeded  int   // Tasks finished
+	Retried    int   // Retries scheduled
+	Failed     int   // Tasks given up on
+	FailedMsgs []Msg // The tasks given up on, in order
+	Cancelled  bool
+	Dropped    []Msg
+	SourceErr  error // Why the FarmSource failed, if it did
+	Skipped    int   // Tasks completed before, by the checkpoint
+	Redone     int   // Tasks dispatched before, but not completed
+}
 
+// EndSentinel, sent on a farm's DistChan or dispatched, completes
+// its input.  See FarmSourcer.
 type EndSentinel struct{}
 
+// ReceiveTimeout is sent by the system to an actor which has had
+// no messages for the duration given in
+// ActorOptions.ReceiveTimeout or ActorEnv.SetReceiveTimeout().
+// While the actor stays idle it is sent again at that interval.
+type ReceiveTimeout struct{}
+
 // ChildDied is sent to the parent of any actor which
 // experiences a panic.  The message includes the
 // panic thrown, the actor which suffered the panic,
-// and the Msg on which the actor was working.
+// the Msg on which the actor was working, and the stack
+// trace of the panicking goroutine.
 type ChildDied struct {
 	Err     interface{}
 	A       *Actor
 	Message Msg
+	Stack   []byte
+}
+
+// Exit is delivered to an actor which traps exits (see
+// ActorEnv.TrapExits()) when an actor linked to it dies.
+type Exit struct {
+	From   *Actor
+	Reason Reason
 }
 
 // "Receive" is the external interface to an actor,
@@ -65,12 +103,120 @@ type FarmClass interface {
 	GetMaxWorkers() int
 }
 
+// FarmMode selects how a farm uses its workers.
+type FarmMode int
+
+const (
+	// OneShot spawns a new worker from GenWorker() for each
+	// message, which is expected to Suicide() once it has handled
+	// it.  At most MaxWorkers are alive at once.
+	OneShot FarmMode = iota
+	// WorkerPool spawns MaxWorkers long-lived workers once, and
+	// hands each message to a worker whose Receive has returned
+	// from its last.  A worker which panics is replaced, as is one
+	// which dies.  Once all work is done the workers are told to
+	// die, then WorkComplete is sent.  GenWorker() must return a
+	// Receive or *ActorOptions in this mode; if the pool has no
+	// workers and none can be made, the waiting tasks are Failed
+	// and the farm completes.
+	WorkerPool
+)
+
+// FarmRetry is a farm's policy for a task whose worker panicked.
+// The task is dispatched again, up to MaxAttempts times in all,
+// as long as Retryable (if set) says the panic value is worth
+// retrying.  Retries wait as Backoff (if set) says, counting
+// from a task's first retry; its ResetAfter and Pending are not
+// used.
+type FarmRetry struct {
+	MaxAttempts int
+	Backoff     *Backoff
+	Retryable   func(err interface{}) bool
+}
+
+// FarmRetrier is implemented by a FarmClass which retries failed
+// tasks.  A FarmClass which does not gives up on them at once.
+type FarmRetrier interface {
+	GetRetry() *FarmRetry
+}
+
+// FarmAutoscale lets a WorkerPool farm size its pool to its
+// backlog.  The pool starts with MinWorkers, and a worker is
+// added, up to MaxWorkers, whenever a task is waiting with none
+// idle and either more than ScaleUpQueue tasks are waiting or the
+// oldest has waited ScaleUpLatency.  With neither threshold set,
+// any waiting task adds a worker, as it does to a pool with no
+// workers at all.  A worker idle for
+// ScaleDownIdle is retired, down to MinWorkers; a zero
+// ScaleDownIdle never retires them.  A OneShot farm just runs up
+// to MaxWorkers at once.  GetMaxWorkers() is not used.
+type FarmAutoscale struct {
+	MinWorkers     int
+	MaxWorkers     int
+	ScaleUpQueue   int
+	ScaleUpLatency time.Duration
+	ScaleDownIdle  time.Duration
+}
+
+// FarmAutoscaler is implemented by a FarmClass which autoscales.
+type FarmAutoscaler interface {
+	GetAutoscale() *FarmAutoscale
+}
+
+// FarmStats is the state of a farm, as given in reply to
+// GetFarmStats.  Completed and Failed count tasks as WorkComplete
+// does.
+type FarmStats struct {
+	Queued    int // Tasks waiting for a worker
+	Active    int // Workers with a task
+	Idle      int // Workers without one
+	Completed int
+	Failed    int
+	Paused    bool
+}
+
+// GetFarmStats, sent to a farmer with Ask(), has it Reply() with
+// Msg{FarmStats}.  It is answered by the framework; the farm's
+// FarmReceive does not see it.
+type GetFarmStats struct{}
+
+// PauseFarm, sent to a farmer, stops it handing tasks to workers
+// until ResumeFarm is sent.  Tasks being worked on are finished,
+// and new ones are queued.  This and the other farm control
+// messages are handled by the framework; the farm's FarmReceive
+// does not see them.
+type PauseFarm struct{}
+
+// ResumeFarm, sent to a farmer, undoes PauseFarm.
+type ResumeFarm struct{}
+
+// DrainFarm, sent to a farmer, has it take no more tasks from its
+// source, finish those it has (resuming it if paused), and then
+// send WorkComplete, as the source completing does.
+type DrainFarm struct{}
+
+// CancelFarm, sent to a farmer, has it drop all its tasks, kill
+// its workers, and send a WorkComplete listing the tasks dropped.
+type CancelFarm struct{}
+
+// FarmModer is implemented by a FarmClass which picks its
+// FarmMode.  A FarmClass which does not is OneShot.
+type FarmModer interface {
+	GetMode() FarmMode
+}
+
 // FarmInfo is a type which can be embedded into a FarmClass.
-// Setting the two values provides the GetDistChan() and
-// GetMaxWorkers() functions for free
+// Setting the values provides the GetDistChan(), GetMaxWorkers(),
+// GetMode(), GetRetry(), GetAutoscale(), GetSource() and
+// GetCheckpoint() functions for free
 type FarmInfo struct {
 	MaxWorkers int
 	DistChan   chan Msg
+	Mode       FarmMode
+	Retry      *FarmRetry
+	Autoscale  *FarmAutoscale
+	Source     FarmSource
+	Checkpoint *FarmCheckpoint
 }
 
 func (f *FarmInfo) GoString() {
@@ -86,12 +232,18 @@ type SetupFunc func(interface{}) ActorClass
 // ActorGroup.NewOptionedActor()
 
 type ActorOptions struct {
-	Receive      func(msg Msg, env *ActorEnv)
-	FirstMessage Msg            //Sent immediately upon birth
-	LastMessage  Msg            //Sent immediately prior to death
-	Validator    func(Msg) bool //Applied to incoming messages
-	AgeOut       time.Duration  //System generates Suicide()
-	Farm         FarmClass      //Only use this or Receive
+	Receive        func(msg Msg, env *ActorEnv)
+	FirstMessage   Msg                //Sent immediately upon birth
+	LastMessage    Msg                //Sent immediately prior to death
+	Validator      func(Msg) bool     //Applied to incoming messages
+	AgeOut         time.Duration      //System generates Suicide()
+	Farm           FarmClass          //Only use this or Receive
+	Supervisor     SupervisorStrategy //Handles ChildDied of children
+	Backoff        *Backoff           //Delays Supervisor's restarts
+	Mailbox        Mailbox            //Bounds queued messages
+	StashCapacity  int                //Zero is unbounded
+	ReceiveTimeout time.Duration      //Idle time before ReceiveTimeout{}
+	Persistence    *Persistence       //Makes the actor event sourced
 }
 
 type ActorClass interface {
@@ -110,15 +262,46 @@ func (f *FarmInfo) GetMaxWorkers() int {
 	return f.MaxWorkers
 }
 
+// GetMode() is a helper method when creating factories.
+// See type FarmInfo.
+func (f *FarmInfo) GetMode() FarmMode {
+	return f.Mode
+}
+
+// GetRetry() is a helper method when creating factories.
+// See type FarmInfo.
+func (f *FarmInfo) GetRetry() *FarmRetry {
+	return f.Retry
+}
+
+// GetAutoscale() is a helper method when creating factories.
+// See type FarmInfo.
+func (f *FarmInfo) GetAutoscale() *FarmAutoscale {
+	return f.Autoscale
+}
+
+// GetSource() is a helper method when creating factories.
+// See type FarmInfo.
+func (f *FarmInfo) GetSource() FarmSource {
+	return f.Source
+}
+
+// GetCheckpoint() is a helper method when creating factories.
+// See type FarmInfo.
+func (f *FarmInfo) GetCheckpoint() *FarmCheckpoint {
+	return f.Checkpoint
+}
+
 // Obit is the type sent as the result of a monitored's
 // actor dying.
 type Obit struct {
-	A     *Actor
-	Fname string
+	A      *Actor
+	Fname  string
+	Reason Reason
 }
 
 func (o Obit) GoString() string {
-	return fmt.Sprintf("Obit{%s}", o.Fname)
+	return fmt.Sprintf("Obit{%s: %s}", o.Fname, o.Reason)
 }
 
 // DBesp is returned by all ActorGroup.DB* functions.
@@ -147,17 +330,47 @@ type cRemoveChild struct {
 }
 
 type cAddChild struct {
+	id      string
+	a       *Actor
+	restart bool // Of a child whose name is kept for it
+	resp    chan bool
+}
+
+type cGetChildren struct {
+	resp chan []*Actor
+}
+
+type cSendChild struct {
 	id   string
-	a    *Actor
-	resp chan bool
+	msg  Msg
+	resp chan tChildRoute
+}
+
+type cRestarted struct {
+	id string
+	a  *Actor
 }
 
 type cAddWatcher struct {
-	a *Actor
+	a tWatcher
 }
 
 type cDelWatcher struct {
-	a *Actor
+	a tWatcher
+}
+
+type cLink struct {
+	a   *Actor
+	add bool
+}
+
+type cTrapExits struct {
+	val bool
+}
+
+type cExitSignal struct {
+	from   *Actor
+	reason Reason
 }
 
 type cSetObitHook struct {
@@ -201,7 +414,14 @@ type sHappyDeath struct{}
 
 type sReceiveFinished struct{}
 
-type sTombstone struct{}
+type sExit struct {
+	reason  Reason
+	restart bool // By a supervisor
+}
+
+type sReceiveTimeout struct {
+	d time.Duration
+}
 
 // Data types beginning with t are regular types
 
@@ -218,6 +438,46 @@ type tFarmData struct {
 	actorReceiver Receive
 }
 
+// tSpec records what an actor was created from, so that a
+// supervisor can recreate it.
+type tSpec struct {
+	receive interface{}
+	options *ActorOptions
+}
+
+// tDeathNotice is a watcher which is closed upon the death of
+// the actor it watches.
+type tDeathNotice chan tEmptyStruct
+
+func (d tDeathNotice) obit(deceased *Actor, fname string, reason Reason) {
+	close(d)
+}
+
+// tChildRoute tells SendByName() where its message should go.
+// A held message has already been taken care of.
+type tChildRoute struct {
+	a     *Actor
+	found bool
+}
+
+type tBackoffState struct {
+	attempts int
+	started  time.Time
+}
+
 type tNamer interface {
 	fullName() string
 }
+
+// tWatcher is anything which can be sent an obit -- normally
+// another actor, but also a Future waiting on an Ask().
+type tWatcher interface {
+	obit(deceased *Actor, fname string, reason Reason)
+}
+
+// tAsk wraps a message sent by Ask(), carrying the Future on
+// which the receiver's Reply() is delivered.
+type tAsk struct {
+	f   *Future
+	msg Msg
+}
@@ -15,20 +15,6 @@ func init() {
 
 /* ---- UTILITY FUNCTIONS ---- */
 
-func safeSend(dest chan interface{}, msg interface{},
-	from tNamer, err string) {
-	defer errLogWithText(from, err)
-	dest <- msg
-}
-
-func sendIgnoreErr(dest chan interface{}, msg interface{}) {
-	defer func() {
-		if r := recover(); r != nil {
-		}
-	}()
-	dest <- msg
-}
-
 // TODO: Remove Debug() from final version
 func Debug(a bool) {
 	_DODEBUG = a
@@ -52,19 +38,41 @@ func elog(a tNamer, v ...interface{}) {
 func receiverFromClass(suf SetupFunc,
 	ch chan interface{}) Receive {
 
-	if ch != nil {
-		param := <-ch
-		return suf(param).Receive
-	}
-	return suf(nil).Receive
+	return classFromSetup(suf, ch).Receive
 }
 
-func genFarmReceiveAdaptor(distCh chan Msg,
-	r FarmReceive) Receive {
-	disp := func(msg Msg) {
-		distCh <- msg
-	}
+// genFarmReceiveAdaptor passes the tasks its FarmReceive
+// dispatches, and each ChildDied of a worker, to the farm's
+// manager, and handles GetFarmStats and the farm control
+// messages.
+func genFarmReceiveAdaptor(link *tFarmLink, r FarmReceive) Receive {
 	return func(msg Msg, env *ActorEnv) {
+		disp := func(msg Msg) {
+			select {
+			case link.tasks <- msg:
+			case <-link.done:
+				rejectTask(env, msg)
+			}
+		}
+		if len(msg) > 0 {
+			switch m := msg[0].(type) {
+			case GetFarmStats:
+				env.Reply(Msg{link.getStats()})
+				return
+			case PauseFarm, ResumeFarm, DrainFarm, CancelFarm:
+				select {
+				case link.control <- m:
+				case <-link.done:
+				}
+				return
+			case ChildDied:
+				select {
+				case link.failures <- m:
+				case <-link.done:
+				case <-env.Context().Done():
+				}
+			}
+		}
 		r(msg, env, disp)
 	}
 }